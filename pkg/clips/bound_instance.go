@@ -0,0 +1,218 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// instanceBinding links an instance to the Go struct it was inserted from
+type instanceBinding struct {
+	ptr reflect.Value
+	// the options the instance was inserted with, for nested structs inserted by Sync
+	opts []InsertClassOption
+	// field values as of the last Sync or Refresh, by slot name
+	synced map[string]interface{}
+}
+
+func checkBindable(basis interface{}) error {
+	ptr := reflect.ValueOf(basis)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() || ptr.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("BindInstance requires a non-nil pointer to a struct, got %T", basis)
+	}
+	return nil
+}
+
+func (inst *Instance) bind(basis interface{}, opts ...InsertClassOption) {
+	inst.binding = &instanceBinding{
+		ptr:  reflect.ValueOf(basis),
+		opts: opts,
+	}
+	inst.binding.snapshot()
+	inst.env.bound[inst] = struct{}{}
+}
+
+// Bound returns true if this instance is linked to a Go struct
+func (inst *Instance) Bound() bool {
+	return inst.binding != nil
+}
+
+// Unbind removes the link between this instance and its Go struct. Dropping the instance unbinds it
+func (inst *Instance) Unbind() {
+	delete(inst.env.bound, inst)
+	inst.binding = nil
+}
+
+// Sync copies changes made to the bound Go struct into the instance. Only the
+// slots of fields that changed since the last Sync or Refresh are written. The
+// instance held for a nested struct, rather than a pointer, is updated in place
+func (inst *Instance) Sync() error {
+	if inst.binding == nil {
+		return fmt.Errorf("Instance %s is not bound to a Go value", inst.Name())
+	}
+	val := inst.binding.ptr.Elem()
+	knownBases := make(map[reflect.Value]InstanceName)
+	knownBases[val] = inst.Name()
+	return boundFields(val, func(field reflect.StructField, fieldval reflect.Value) error {
+		name := slotNameFor(field)
+		if !fieldChanged(inst.binding.synced[name], fieldval) {
+			return nil
+		}
+		if err := inst.syncSlot(inst.env.planField(field), fieldval, knownBases); err != nil {
+			return err
+		}
+		inst.binding.synced[name] = snapshotField(fieldval)
+		return nil
+	})
+}
+
+// syncSlot writes a field into its slot. A nested struct value already held as an instance is
+// written into that instance, rather than replacing it with a new one
+func (inst *Instance) syncSlot(plan fieldPlan, fieldval reflect.Value, knownBases map[reflect.Value]InstanceName) error {
+	if plan.embedded != nil {
+		if fieldval.Kind() == reflect.Ptr {
+			if fieldval.IsNil() {
+				return nil
+			}
+			fieldval = fieldval.Elem()
+		}
+		for ii, subplan := range inst.env.planFor(plan.embedded).fields {
+			if err := inst.syncSlot(subplan, fieldval.Field(ii), knownBases); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if plan.converted || plan.tag.omit || fieldval.Kind() != reflect.Struct {
+		return inst.fillSlot(plan, fieldval, knownBases, inst.binding.opts...)
+	}
+	current, err := inst.Slot(plan.tag.name)
+	if err != nil {
+		return err
+	}
+	name, ok := current.(InstanceName)
+	if !ok {
+		return inst.fillSlot(plan, fieldval, knownBases, inst.binding.opts...)
+	}
+	subinst, err := inst.env.FindInstance(name, "")
+	if err != nil {
+		return inst.fillSlot(plan, fieldval, knownBases, inst.binding.opts...)
+	}
+	defer subinst.Drop()
+	knownBases[fieldval] = name
+	for ii, subplan := range inst.env.planFor(fieldval.Type()).fields {
+		if err := subinst.syncSlot(subplan, fieldval.Field(ii), knownBases); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Refresh copies the slot values of the instance, which may have been changed
+// by rules, back into the bound Go struct
+func (inst *Instance) Refresh() error {
+	if inst.binding == nil {
+		return fmt.Errorf("Instance %s is not bound to a Go value", inst.Name())
+	}
+	if err := inst.Extract(inst.binding.ptr.Interface()); err != nil {
+		return err
+	}
+	inst.binding.snapshot()
+	return nil
+}
+
+// RefreshErrors returns the errors from refreshing bound instances after each Run since it was
+// last called, one per instance that failed, and clears them. It returns nil if there were none
+func (env *Environment) RefreshErrors() []error {
+	errs := env.refreshErrs
+	env.refreshErrs = nil
+	return errs
+}
+
+// refreshBound refreshes all bound instances, unbinding those that no longer exist. Errors are kept for RefreshErrors
+func (env *Environment) refreshBound() {
+	for inst := range env.bound {
+		if checkInstance(env, inst.instptr) != nil {
+			inst.Unbind()
+			continue
+		}
+		if err := inst.Refresh(); err != nil {
+			env.refreshErrs = append(env.refreshErrs, fmt.Errorf("Unable to refresh instance %s: %v", inst.Name(), err))
+		}
+	}
+}
+
+func (b *instanceBinding) snapshot() {
+	b.synced = make(map[string]interface{})
+	boundFields(b.ptr.Elem(), func(field reflect.StructField, fieldval reflect.Value) error {
+		b.synced[slotNameFor(field)] = snapshotField(fieldval)
+		return nil
+	})
+}
+
+// boundFields calls fn for each field that maps to a slot, treating fields of anonymous structs as native
+func boundFields(val reflect.Value, fn func(field reflect.StructField, fieldval reflect.Value) error) error {
+	typ := val.Type()
+	for ii := 0; ii < typ.NumField(); ii++ {
+		field := typ.Field(ii)
+		fieldval := val.Field(ii)
+		if _, ok := embeddedStruct(field); ok {
+			if fieldval.Kind() == reflect.Ptr {
+				if fieldval.IsNil() {
+					continue
+				}
+				fieldval = fieldval.Elem()
+			}
+			if err := boundFields(fieldval, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(field, fieldval); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotField copies a field value so that later changes made through the struct can be detected
+func snapshotField(val reflect.Value) interface{} {
+	switch val.Kind() {
+	case reflect.Slice:
+		if val.IsNil() {
+			return val.Interface()
+		}
+		ret := reflect.MakeSlice(val.Type(), val.Len(), val.Len())
+		reflect.Copy(ret, val)
+		return ret.Interface()
+	case reflect.Ptr:
+		if val.IsNil() || val.Elem().Kind() == reflect.Struct {
+			// nested structs are instances of their own, so only the reference matters
+			return val.Interface()
+		}
+		ret := reflect.New(val.Type().Elem())
+		ret.Elem().Set(val.Elem())
+		return ret.Interface()
+	}
+	return val.Interface()
+}
+
+func fieldChanged(synced interface{}, val reflect.Value) bool {
+	if val.Kind() == reflect.Ptr && val.Type().Elem().Kind() == reflect.Struct {
+		return synced != val.Interface()
+	}
+	return !reflect.DeepEqual(synced, val.Interface())
+}
@@ -0,0 +1,231 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestBoundInstance(t *testing.T) {
+	type Counter struct {
+		Name  string `clips:"Label"`
+		Count int
+		Tags  []Symbol
+	}
+
+	t.Run("Sync", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		data := &Counter{
+			Name:  "first",
+			Count: 1,
+		}
+		inst, err := env.Insert("counter", data, BindInstance)
+		assert.NilError(t, err)
+		assert.Assert(t, inst.Bound())
+
+		data.Count = 2
+		data.Tags = []Symbol{"a", "b"}
+		err = inst.Sync()
+		assert.NilError(t, err)
+		assert.Equal(t, inst.String(), `[counter] of Counter (Label "first") (Count 2) (Tags a b)`)
+
+		// changes to slice contents are seen as well
+		data.Tags[1] = "c"
+		err = inst.Sync()
+		assert.NilError(t, err)
+		assert.Equal(t, inst.String(), `[counter] of Counter (Label "first") (Count 2) (Tags a c)`)
+	})
+
+	t.Run("Sync nested struct", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		type Address struct {
+			City string
+		}
+		type Resident struct {
+			Name string
+			Home Address
+		}
+		data := &Resident{Name: "a", Home: Address{City: "Paris"}}
+		inst, err := env.Insert("resident", data, BindInstance)
+		assert.NilError(t, err)
+		home, err := inst.Slot("Home")
+		assert.NilError(t, err)
+
+		data.Home.City = "Rome"
+		err = inst.Sync()
+		assert.NilError(t, err)
+		synced, err := inst.Slot("Home")
+		assert.NilError(t, err)
+		assert.Equal(t, synced, home)
+
+		cls, err := env.FindClass("Address")
+		assert.NilError(t, err)
+		assert.Equal(t, len(cls.Instances()), 1)
+		sub, err := env.FindInstance(home.(InstanceName), "")
+		assert.NilError(t, err)
+		city, err := sub.Slot("City")
+		assert.NilError(t, err)
+		assert.Equal(t, city, "Rome")
+	})
+
+	t.Run("Refresh", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		data := &Counter{
+			Name: "first",
+		}
+		inst, err := env.Insert("counter", data, BindInstance)
+		assert.NilError(t, err)
+
+		err = inst.SetSlot("Count", 5)
+		assert.NilError(t, err)
+		assert.Equal(t, data.Count, 0)
+
+		err = inst.Refresh()
+		assert.NilError(t, err)
+		assert.Equal(t, data.Count, 5)
+		assert.Equal(t, data.Name, "first")
+	})
+
+	t.Run("Refresh after Run", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		data := &Counter{
+			Name:  "first",
+			Count: 1,
+		}
+		_, err := env.Insert("counter", data, BindInstance)
+		assert.NilError(t, err)
+
+		err = env.Build(`(defrule increment
+			?c <- (object (is-a Counter) (Count ?n&:(< ?n 3)))
+			=>
+			(send ?c put-Count (+ ?n 1)))`)
+		assert.NilError(t, err)
+
+		env.Run(-1)
+		assert.Equal(t, data.Count, 3)
+	})
+
+	t.Run("Dirty tracking", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		data := &Counter{
+			Name: "first",
+		}
+		inst, err := env.Insert("counter", data, BindInstance)
+		assert.NilError(t, err)
+
+		// changed in CLIPS but not in Go; Sync leaves it alone
+		err = inst.SetSlot("Count", 5)
+		assert.NilError(t, err)
+		data.Name = "second"
+		err = inst.Sync()
+		assert.NilError(t, err)
+		assert.Equal(t, inst.String(), `[counter] of Counter (Label "second") (Count 5) (Tags)`)
+	})
+
+	t.Run("Deleted instance", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		data := &Counter{}
+		inst, err := env.Insert("counter", data, BindInstance)
+		assert.NilError(t, err)
+
+		err = inst.Delete()
+		assert.NilError(t, err)
+		env.Run(-1)
+		assert.Assert(t, !inst.Bound())
+	})
+
+	t.Run("Unbound instance", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		data := &Counter{}
+		inst, err := env.Insert("counter", data)
+		assert.NilError(t, err)
+		assert.Assert(t, !inst.Bound())
+		assert.ErrorContains(t, inst.Sync(), "not bound")
+		assert.ErrorContains(t, inst.Refresh(), "not bound")
+
+		inst, err = env.Insert("bound", data, BindInstance)
+		assert.NilError(t, err)
+		inst.Unbind()
+		assert.ErrorContains(t, inst.Sync(), "not bound")
+	})
+
+	t.Run("Dropped instance", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		data := &Counter{}
+		inst, err := env.Insert("counter", data, BindInstance)
+		assert.NilError(t, err)
+		assert.Equal(t, len(env.bound), 1)
+		inst.Drop()
+		assert.Assert(t, !inst.Bound())
+		assert.Equal(t, len(env.bound), 0)
+	})
+
+	t.Run("Refresh error after Run", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		type Gauge struct {
+			Level int `clips:",range=0..10"`
+		}
+		data := &Gauge{Level: 1}
+		_, err := env.Insert("gauge", data, BindInstance)
+		assert.NilError(t, err)
+		err = env.Build(`(defrule overflow
+			?g <- (object (is-a Gauge) (Level ?n&:(< ?n 20)))
+			=>
+			(send ?g put-Level 20))`)
+		assert.NilError(t, err)
+
+		other := &Gauge{Level: 2}
+		_, err = env.Insert("other", other, BindInstance)
+		assert.NilError(t, err)
+
+		env.Run(-1)
+		errs := env.RefreshErrors()
+		assert.Equal(t, len(errs), 2)
+		assert.ErrorContains(t, errs[0], "above the range")
+		assert.ErrorContains(t, errs[1], "above the range")
+		assert.Equal(t, len(env.RefreshErrors()), 0)
+		assert.Equal(t, data.Level, 1)
+	})
+
+	t.Run("Bind requires pointer", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := env.Insert("counter", Counter{}, BindInstance)
+		assert.ErrorContains(t, err, "pointer to a struct")
+		_, err = env.FindInstance("counter", "")
+		assert.ErrorContains(t, err, "not found")
+	})
+}
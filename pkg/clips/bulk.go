@@ -0,0 +1,248 @@
+package clips
+
+// #cgo CFLAGS: -I ../../clips_source
+// #cgo LDFLAGS: -L ../../clips_source -l clips -lm
+// #include <clips/clips.h>
+import "C"
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// DeferPatternMatching makes InsertAll delay pattern matching until the whole batch has been
+// inserted, as object-pattern-match-delay does. CLIPS always matches facts as they are asserted,
+// so it has no effect on AssertAll
+const DeferPatternMatching InsertClassOption = "DeferPatternMatching"
+
+// TemplateKey is the key naming the template of a map passed to AssertAll, e.g.
+//
+//	map[string]interface{}{clips.TemplateKey: "person", "name": "Bob"}
+const TemplateKey = "?template"
+
+// batchCache holds what has been looked up for each type while asserting or inserting a batch
+type batchCache struct {
+	templates map[reflect.Type]*Template
+	named     map[string]*Template
+	classes   map[string]*Class
+	plans     map[reflect.Type]*structPlan
+}
+
+// structPlan is how the fields of a struct type become slots, worked out once per type while a
+// batch is loaded rather than for every element
+type structPlan struct {
+	fields []fieldPlan
+	// index of the key field, or nil if there is none
+	key []int
+}
+
+// fieldPlan is how one field becomes a slot
+type fieldPlan struct {
+	field reflect.StructField
+	// the struct type of an anonymous field, whose fields are treated as native
+	embedded reflect.Type
+	tag      slotTag
+	// whether a converter handles the field's type
+	converted bool
+}
+
+// AssertAll asserts every element of facts, which must be a slice. Elements may be structs or
+// pointers to structs, asserted as by AssertStruct with the given options; maps with the template
+// named by TemplateKey; fact literals as given to AssertString; or facts that have not yet been
+// asserted. The template, slot names, tags and converters of each struct type are worked out once
+// for the batch. Map values are set as by Fact.Set, without being checked against the slot
+// constraints first as Template.Assert does. No Fact is kept for the facts asserted. The number
+// of facts asserted is returned, even when an element fails
+func (env *Environment) AssertAll(facts interface{}, opts ...InsertClassOption) (int, error) {
+	list, err := batchSlice(facts)
+	if err != nil {
+		return 0, err
+	}
+	defer env.startBatch()()
+	for ii := 0; ii < list.Len(); ii++ {
+		if err := env.assertElement(list.Index(ii).Interface(), opts...); err != nil {
+			return ii, fmt.Errorf("Unable to assert element %d: %v", ii, err)
+		}
+	}
+	return list.Len(), nil
+}
+
+// InsertAll inserts every struct in instances, which must be a slice, as by Insert with the given
+// options. The class, slot names, tags and converters of each type are worked out once for the
+// batch. Instances are named by their key field, if any, or by CLIPS. If DeferPatternMatching is
+// given, rules see the instances only once the whole batch is in. The number of instances
+// inserted is returned, even when an element fails
+func (env *Environment) InsertAll(instances interface{}, opts ...InsertClassOption) (int, error) {
+	list, err := batchSlice(instances)
+	if err != nil {
+		return 0, err
+	}
+	for _, opt := range opts {
+		if opt == BindInstance {
+			return 0, fmt.Errorf("Unable to bind instances inserted by InsertAll")
+		}
+	}
+	if hasOption(opts, DeferPatternMatching) {
+		delay := C.EnvGetDelayObjectPatternMatching(env.env)
+		C.EnvSetDelayObjectPatternMatching(env.env, 1)
+		defer C.EnvSetDelayObjectPatternMatching(env.env, delay)
+	}
+	defer env.startBatch()()
+	for ii := 0; ii < list.Len(); ii++ {
+		basis := list.Index(ii).Interface()
+		if basis == nil {
+			return ii, fmt.Errorf("Unable to insert element %d: nil value", ii)
+		}
+		inst, err := env.insertInstance("", basis, make(map[reflect.Value]InstanceName), opts...)
+		if err != nil {
+			return ii, fmt.Errorf("Unable to insert element %d: %v", ii, err)
+		}
+		inst.Drop()
+	}
+	return list.Len(), nil
+}
+
+func batchSlice(values interface{}) (reflect.Value, error) {
+	val := reflect.ValueOf(values)
+	if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+		return reflect.Value{}, fmt.Errorf("Expected a slice, got %T", values)
+	}
+	return val, nil
+}
+
+// startBatch starts caching lookups by type, returning a function that ends the batch. Batches
+// may nest, in which case the outermost one keeps the cache
+func (env *Environment) startBatch() func() {
+	if env.batch != nil {
+		return func() {}
+	}
+	env.batch = &batchCache{
+		templates: make(map[reflect.Type]*Template),
+		named:     make(map[string]*Template),
+		classes:   make(map[string]*Class),
+		plans:     make(map[reflect.Type]*structPlan),
+	}
+	return func() {
+		env.batch = nil
+	}
+}
+
+// planFor returns the plan for a struct type, kept for the rest of the batch if one is running
+func (env *Environment) planFor(typ reflect.Type) *structPlan {
+	if env.batch != nil {
+		if plan, ok := env.batch.plans[typ]; ok {
+			return plan
+		}
+	}
+	plan := &structPlan{
+		fields: make([]fieldPlan, typ.NumField()),
+	}
+	for ii := range plan.fields {
+		plan.fields[ii] = env.planField(typ.Field(ii))
+	}
+	if keyfield, ok := keyFieldFor(typ); ok {
+		plan.key = keyfield.Index
+	}
+	if env.batch != nil {
+		env.batch.plans[typ] = plan
+	}
+	return plan
+}
+
+func (env *Environment) planField(field reflect.StructField) fieldPlan {
+	ret := fieldPlan{
+		field: field,
+	}
+	if embedded, ok := embeddedStruct(field); ok {
+		ret.embedded = embedded
+		return ret
+	}
+	ret.tag = slotTagFor(field)
+	_, ret.converted = env.fieldConverter(field.Type)
+	return ret
+}
+
+func (env *Environment) assertElement(elem interface{}, opts ...InsertClassOption) error {
+	switch v := elem.(type) {
+	case string:
+		cfactstr := C.CString(v)
+		defer C.free(unsafe.Pointer(cfactstr))
+		if C.EnvAssertString(env.env, cfactstr) == nil {
+			return EnvError(env, `Error asserting fact "%s"`, v)
+		}
+		return nil
+	case Fact:
+		return v.Assert()
+	case map[string]interface{}:
+		return env.assertMap(v)
+	}
+	knownFacts := make(map[reflect.Value]Fact)
+	fact, err := env.assertStruct(reflect.ValueOf(elem), knownFacts, make(map[reflect.Value]bool), opts...)
+	if err != nil {
+		retractNested(knownFacts)
+		return err
+	}
+	fact.Drop()
+	return nil
+}
+
+func (env *Environment) assertMap(slots map[string]interface{}) error {
+	name, ok := slots[TemplateKey].(string)
+	if !ok {
+		return fmt.Errorf("Map has no template name under %s", TemplateKey)
+	}
+	tpl, ok := env.batch.named[name]
+	if !ok {
+		var err error
+		if tpl, err = env.FindTemplate(name); err != nil {
+			return err
+		}
+		env.batch.named[name] = tpl
+	}
+	if tpl.Implied() {
+		values := make(map[string]interface{}, len(slots)-1)
+		for slot, value := range slots {
+			if slot != TemplateKey {
+				values[slot] = value
+			}
+		}
+		fact, err := tpl.Assert(values)
+		if err != nil {
+			return err
+		}
+		fact.Drop()
+		return nil
+	}
+	// set directly; CLIPS reports an unknown slot, and Template.Assert's checks cost a round trip
+	// per slot
+	fact, err := tpl.NewFact()
+	if err != nil {
+		return err
+	}
+	tfact := fact.(*TemplateFact)
+	defer tfact.Drop()
+	for slot, value := range slots {
+		if slot == TemplateKey {
+			continue
+		}
+		if err := tfact.Set(slot, value); err != nil {
+			return err
+		}
+	}
+	return tfact.Assert()
+}
@@ -0,0 +1,216 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"reflect"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+type BulkRecord struct {
+	ID    int
+	Value float64
+}
+
+// BulkProbe is converted when each record is inserted, so it can look at the agenda mid-batch
+type BulkProbe struct{}
+
+type ProbedRecord struct {
+	ID    int
+	Probe BulkProbe
+}
+
+func bulkRecords(n int) []BulkRecord {
+	records := make([]BulkRecord, n)
+	for ii := range records {
+		records[ii] = BulkRecord{ID: ii, Value: float64(ii) / 2}
+	}
+	return records
+}
+
+func TestAssertAll(t *testing.T) {
+	t.Run("Structs", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		records := bulkRecords(100)
+		count, err := env.AssertAll(records)
+		assert.NilError(t, err)
+		assert.Equal(t, count, 100)
+
+		var out []BulkRecord
+		it, err := env.QueryFacts("BulkRecord", nil)
+		assert.NilError(t, err)
+		err = it.ExtractAll(&out)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, out, records)
+		assert.Assert(t, env.batch == nil)
+	})
+
+	t.Run("Mixed", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(deftemplate person (slot name) (slot age))")
+		assert.NilError(t, err)
+		count, err := env.AssertAll([]interface{}{
+			`(foo a b c)`,
+			map[string]interface{}{TemplateKey: "person", "name": "bob", "age": 30},
+			&BulkRecord{ID: 1},
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, count, 3)
+
+		fact, err := env.FactByIndex(2)
+		assert.NilError(t, err)
+		assert.Equal(t, fact.String(), `(person (name "bob") (age 30))`)
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		count, err := env.AssertAll([]interface{}{
+			`(foo a b c)`,
+			map[string]interface{}{"name": "bob"},
+			`(bar)`,
+		})
+		assert.ErrorContains(t, err, "element 1")
+		assert.Equal(t, count, 1)
+
+		_, err = env.AssertAll(BulkRecord{})
+		assert.ErrorContains(t, err, "Expected a slice")
+
+		err = env.Build("(deftemplate person (slot name))")
+		assert.NilError(t, err)
+		count, err = env.AssertAll([]interface{}{
+			map[string]interface{}{TemplateKey: "person", "nosuch": 1},
+		})
+		assert.ErrorContains(t, err, `does not have slot "nosuch"`)
+		assert.Equal(t, count, 0)
+	})
+
+	t.Run("Plans kept for the batch", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		typ := reflect.TypeOf(BulkRecord{})
+		assert.Assert(t, env.planFor(typ) != env.planFor(typ))
+
+		end := env.startBatch()
+		plan := env.planFor(typ)
+		assert.Equal(t, env.planFor(typ), plan)
+		assert.Equal(t, len(plan.fields), 2)
+		assert.Equal(t, plan.fields[1].tag.name, "Value")
+		end()
+		assert.Assert(t, env.batch == nil)
+	})
+}
+
+func TestInsertAll(t *testing.T) {
+	t.Run("Insert", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		records := []*BulkRecord{{ID: 1, Value: 0.5}, {ID: 2, Value: 1.5}}
+		count, err := env.InsertAll(records)
+		assert.NilError(t, err)
+		assert.Equal(t, count, 2)
+
+		cls, err := env.FindClass("BulkRecord")
+		assert.NilError(t, err)
+		assert.Equal(t, len(cls.Instances()), 2)
+	})
+
+	t.Run("Deferred pattern matching", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		activations := 0
+		env.RegisterConverter(reflect.TypeOf(BulkProbe{}), INTEGER, func(value interface{}) (interface{}, error) {
+			if n := len(env.Activations()); n > activations {
+				activations = n
+			}
+			return 0, nil
+		}, func(value interface{}) (interface{}, error) {
+			return BulkProbe{}, nil
+		})
+		_, err := env.InsertClass(ProbedRecord{})
+		assert.NilError(t, err)
+		err = env.Build(`(defrule count-records (object (is-a ProbedRecord)) => (assert (seen)))`)
+		assert.NilError(t, err)
+
+		records := []ProbedRecord{{ID: 1}, {ID: 2}, {ID: 3}}
+		count, err := env.InsertAll(records)
+		assert.NilError(t, err)
+		assert.Equal(t, count, 3)
+		// without the option, earlier records are matched while later ones are inserted
+		assert.Assert(t, activations > 0)
+		assert.Equal(t, env.Run(-1), int64(3))
+
+		activations = 0
+		records = []ProbedRecord{{ID: 4}, {ID: 5}, {ID: 6}}
+		count, err = env.InsertAll(records, DeferPatternMatching)
+		assert.NilError(t, err)
+		assert.Equal(t, count, 3)
+		assert.Equal(t, activations, 0)
+		assert.Equal(t, len(env.Activations()), 3)
+		delay, err := env.Eval("(get-object-pattern-match-delay)")
+		assert.NilError(t, err)
+		assert.Equal(t, delay, false)
+		assert.Equal(t, env.Run(-1), int64(3))
+
+		_, err = env.InsertAll([]BulkRecord{{ID: 4}}, BindInstance)
+		assert.ErrorContains(t, err, "Unable to bind")
+	})
+}
+
+func BenchmarkAssertAll(b *testing.B) {
+	env := CreateEnvironment()
+	defer env.Delete()
+	records := bulkRecords(1000)
+
+	b.ResetTimer()
+	for ii := 0; ii < b.N; ii++ {
+		if _, err := env.AssertAll(records); err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		env.Reset()
+		b.StartTimer()
+	}
+}
+
+func BenchmarkAssertStruct(b *testing.B) {
+	env := CreateEnvironment()
+	defer env.Delete()
+	records := bulkRecords(1000)
+
+	b.ResetTimer()
+	for ii := 0; ii < b.N; ii++ {
+		for _, record := range records {
+			fact, err := env.AssertStruct(record)
+			if err != nil {
+				b.Fatal(err)
+			}
+			fact.Drop()
+		}
+		b.StopTimer()
+		env.Reset()
+		b.StartTimer()
+	}
+}
@@ -0,0 +1,33 @@
+package clips
+
+// #cgo CFLAGS: -I ../../clips_source
+// #cgo LDFLAGS: -L ../../clips_source -l clips -lm
+// #include <clips/clips.h>
+//
+// long fact_busy_count(void *fact)
+// {
+//   return ((struct fact *)fact)->factHeader.busyCount;
+// }
+import "C"
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import "unsafe"
+
+// busyCount returns how many references CLIPS is keeping the fact for. Tests reach it through
+// export_test.go, as cgo can't be used in test files
+func busyCount(factptr unsafe.Pointer) int {
+	return int(C.fact_busy_count(factptr))
+}
@@ -36,7 +36,7 @@ func printError(env *Environment, err string) {
 
 //export goFunction
 func goFunction(envptr unsafe.Pointer, dataObject *C.struct_dataObject) {
-	env, ok := environmentObj[envptr]
+	env, ok := environmentFor(envptr)
 	if !ok {
 		panic("Got a callback from an unknown environment")
 	}
@@ -129,11 +129,18 @@ func goFunction(envptr unsafe.Pointer, dataObject *C.struct_dataObject) {
 		retlist[i] = retval.Interface()
 	}
 
+	var err error
 	if len(retlist) > 1 {
-		returnData.SetValue(retlist)
+		err = returnData.SetValue(retlist)
 	} else if len(retlist) == 1 {
-		returnData.SetValue(retlist[0])
+		err = returnData.SetValue(retlist[0])
 	} else {
+		err = returnData.SetValue(false)
+	}
+	if err != nil {
 		returnData.SetValue(false)
+		printError(env, fmt.Sprintf("error returning from function %s: %v", funcname, err.Error()))
+		// Call and Eval then fail rather than returning FALSE
+		C.SetEvaluationError(envptr, 1)
 	}
 }
@@ -0,0 +1,238 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// Converter translates values of a Go type to and from a CLIPS representation
+type Converter struct {
+	// ClipsType is the type of slot used to hold converted values
+	ClipsType Type
+
+	// ToCLIPS converts a value of the Go type into a value that clipsgo can pass to CLIPS directly, e.g. a string or int64.
+	// The value must be of ClipsType
+	ToCLIPS func(value interface{}) (interface{}, error)
+
+	// FromCLIPS converts a value obtained from CLIPS into a value of the Go type
+	FromCLIPS func(value interface{}) (interface{}, error)
+}
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// RegisterConverter makes values of goType convert to and from CLIPS using the given functions,
+// wherever values are passed between Go and CLIPS: slots, facts, globals, function calls and
+// callbacks. clipsType is the type of slot generated for goType by InsertClass and InsertTemplate.
+// A registered converter takes precedence over the built-in ones
+func (env *Environment) RegisterConverter(goType reflect.Type, clipsType Type, toCLIPS func(value interface{}) (interface{}, error), fromCLIPS func(value interface{}) (interface{}, error)) {
+	env.converters[goType] = &Converter{
+		ClipsType: clipsType,
+		ToCLIPS:   toCLIPS,
+		FromCLIPS: fromCLIPS,
+	}
+}
+
+// RegisterEpochTimeConverter makes time.Time values convert to and from an INTEGER number of units
+// since the Unix epoch, for example time.Second or time.Millisecond, rather than an ISO 8601 string
+func (env *Environment) RegisterEpochTimeConverter(unit time.Duration) {
+	env.RegisterConverter(timeType, INTEGER, func(value interface{}) (interface{}, error) {
+		return value.(time.Time).UnixNano() / int64(unit), nil
+	}, func(value interface{}) (interface{}, error) {
+		epoch, ok := value.(int64)
+		if !ok {
+			return nil, fmt.Errorf(`Invalid type "%T", expected "int64"`, value)
+		}
+		return time.Unix(0, epoch*int64(unit)), nil
+	})
+}
+
+func (env *Environment) registerBuiltinConverters() {
+	env.RegisterConverter(timeType, STRING, func(value interface{}) (interface{}, error) {
+		return value.(time.Time).Format(time.RFC3339Nano), nil
+	}, func(value interface{}) (interface{}, error) {
+		str, err := lexemeFor(value)
+		if err != nil {
+			return nil, err
+		}
+		return time.Parse(time.RFC3339Nano, str)
+	})
+	env.RegisterConverter(durationType, INTEGER, func(value interface{}) (interface{}, error) {
+		return int64(value.(time.Duration)), nil
+	}, func(value interface{}) (interface{}, error) {
+		// nanoseconds either way, e.g. after arithmetic in CLIPS
+		switch v := value.(type) {
+		case int64:
+			return time.Duration(v), nil
+		case float64:
+			return time.Duration(math.Round(v)), nil
+		}
+		str, err := lexemeFor(value)
+		if err != nil {
+			return nil, err
+		}
+		return time.ParseDuration(str)
+	})
+}
+
+// converterFor returns the converter for typ, if any
+func (env *Environment) converterFor(typ reflect.Type) (*Converter, bool) {
+	if typ == nil {
+		return nil, false
+	}
+	if conv, ok := env.converters[typ]; ok {
+		return conv, true
+	}
+	// pointers are handled through what they point to, so that a registered converter is found
+	if typ.Kind() != reflect.Ptr && reflect.PtrTo(typ).Implements(textMarshalerType) && reflect.PtrTo(typ).Implements(textUnmarshalerType) {
+		return textConverter(typ), true
+	}
+	return nil, false
+}
+
+// fieldConverter returns the converter for typ, or for what it points to
+func (env *Environment) fieldConverter(typ reflect.Type) (*Converter, bool) {
+	if conv, ok := env.converterFor(typ); ok {
+		return conv, true
+	}
+	if typ != nil && typ.Kind() == reflect.Ptr {
+		return env.converterFor(typ.Elem())
+	}
+	return nil, false
+}
+
+// textConverter converts types implementing encoding.TextMarshaler and encoding.TextUnmarshaler to STRING
+func textConverter(typ reflect.Type) *Converter {
+	return &Converter{
+		ClipsType: STRING,
+		ToCLIPS: func(value interface{}) (interface{}, error) {
+			marshaler, ok := value.(encoding.TextMarshaler)
+			if !ok {
+				// the method has a pointer receiver
+				ptr := reflect.New(typ)
+				ptr.Elem().Set(reflect.ValueOf(value))
+				marshaler = ptr.Interface().(encoding.TextMarshaler)
+			}
+			text, err := marshaler.MarshalText()
+			if err != nil {
+				return nil, err
+			}
+			return string(text), nil
+		},
+		FromCLIPS: func(value interface{}) (interface{}, error) {
+			str, err := lexemeFor(value)
+			if err != nil {
+				return nil, err
+			}
+			ptr := reflect.New(typ)
+			if err := ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(str)); err != nil {
+				return nil, err
+			}
+			return ptr.Elem().Interface(), nil
+		},
+	}
+}
+
+func lexemeFor(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case Symbol:
+		return string(v), nil
+	}
+	return "", fmt.Errorf(`Invalid type "%T", expected "string"`, value)
+}
+
+// toCLIPS applies any converter for the type of value
+func (env *Environment) toCLIPS(value interface{}) (interface{}, error) {
+	if value == nil || isNilPointer(value) {
+		return value, nil
+	}
+	val := reflect.ValueOf(value)
+	if conv, ok := env.converterFor(val.Type()); ok {
+		return conv.convert(value)
+	}
+	if val.Kind() == reflect.Ptr {
+		if conv, ok := env.converterFor(val.Type().Elem()); ok {
+			return conv.convert(val.Elem().Interface())
+		}
+	}
+	return value, nil
+}
+
+// convert applies ToCLIPS, checking that the result is of ClipsType
+func (conv *Converter) convert(value interface{}) (interface{}, error) {
+	ret, err := conv.ToCLIPS(value)
+	if err != nil {
+		return nil, err
+	}
+	if typ := clipsTypeFor(reflect.TypeOf(ret)); typ != conv.ClipsType {
+		return nil, fmt.Errorf(`Invalid type "%v" from converter, expected "%v"`, typ, conv.ClipsType)
+	}
+	return ret, nil
+}
+
+// fromCLIPS stores data into target using any converter for its type. It returns false if there is no converter
+func (env *Environment) fromCLIPS(target reflect.Value, data reflect.Value) (bool, error) {
+	conv, ok := env.converterFor(target.Type())
+	if ok {
+		converted, err := conv.FromCLIPS(data.Interface())
+		if err != nil {
+			return true, err
+		}
+		return true, setConverted(target, converted)
+	}
+	if target.Kind() != reflect.Ptr {
+		return false, nil
+	}
+	conv, ok = env.converterFor(target.Type().Elem())
+	if !ok {
+		return false, nil
+	}
+	converted, err := conv.FromCLIPS(data.Interface())
+	if err != nil {
+		return true, err
+	}
+	ptr := reflect.New(target.Type().Elem())
+	if err := setConverted(ptr.Elem(), converted); err != nil {
+		return true, err
+	}
+	target.Set(ptr)
+	return true, nil
+}
+
+func setConverted(target reflect.Value, converted interface{}) error {
+	val := reflect.ValueOf(converted)
+	switch {
+	case !val.IsValid():
+		target.Set(reflect.Zero(target.Type()))
+	case val.Type().AssignableTo(target.Type()):
+		target.Set(val)
+	case val.Type().ConvertibleTo(target.Type()):
+		target.Set(val.Convert(target.Type()))
+	default:
+		return fmt.Errorf(`Invalid type "%v" from converter, expected "%v"`, val.Type(), target.Type())
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+type Celsius struct {
+	Degrees float64
+}
+
+type ConvertedClass struct {
+	At      time.Time
+	Timeout time.Duration
+	Addr    net.IP
+	Expires *time.Time
+	History []time.Time
+}
+
+func registerCelsius(env *Environment) {
+	env.RegisterConverter(reflect.TypeOf(Celsius{}), FLOAT, func(value interface{}) (interface{}, error) {
+		return value.(Celsius).Degrees, nil
+	}, func(value interface{}) (interface{}, error) {
+		degrees, ok := value.(float64)
+		if !ok {
+			return nil, fmt.Errorf(`Invalid type "%T", expected "float64"`, value)
+		}
+		return Celsius{Degrees: degrees}, nil
+	})
+}
+
+func TestConverter(t *testing.T) {
+	when := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("Time conversion", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(defglobal ?*when* = nil)")
+		assert.NilError(t, err)
+		glb, err := env.FindGlobal("when")
+		assert.NilError(t, err)
+		err = glb.SetValue(when)
+		assert.NilError(t, err)
+		ret, err := glb.Value()
+		assert.NilError(t, err)
+		assert.Equal(t, ret, "2020-01-02T03:04:05Z")
+
+		var out time.Time
+		err = env.ExtractEval(&out, "?*when*")
+		assert.NilError(t, err)
+		assert.Assert(t, out.Equal(when))
+	})
+
+	t.Run("Epoch time conversion", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		env.RegisterEpochTimeConverter(time.Second)
+		err := env.Build("(defglobal ?*when* = nil)")
+		assert.NilError(t, err)
+		glb, err := env.FindGlobal("when")
+		assert.NilError(t, err)
+		err = glb.SetValue(when)
+		assert.NilError(t, err)
+		ret, err := glb.Value()
+		assert.NilError(t, err)
+		assert.Equal(t, ret, when.Unix())
+
+		var out time.Time
+		err = env.ExtractEval(&out, "?*when*")
+		assert.NilError(t, err)
+		assert.Assert(t, out.Equal(when))
+	})
+
+	t.Run("Duration conversion", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		var out time.Duration
+		err := env.ExtractEval(&out, "1500000000")
+		assert.NilError(t, err)
+		assert.Equal(t, out, 1500*time.Millisecond)
+
+		err = env.ExtractEval(&out, "(* 1500000000 1.5)")
+		assert.NilError(t, err)
+		assert.Equal(t, out, 2250*time.Millisecond)
+
+		err = env.ExtractEval(&out, `"90s"`)
+		assert.NilError(t, err)
+		assert.Equal(t, out, 90*time.Second)
+	})
+
+	t.Run("Insert class", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		cls, err := env.InsertClass((*ConvertedClass)(nil))
+		assert.NilError(t, err)
+		assert.Equal(t, cls.String(), `(defclass MAIN::ConvertedClass
+   (is-a USER)
+   (slot At
+      (type STRING))
+   (slot Timeout
+      (type INTEGER))
+   (slot Addr
+      (type STRING))
+   (slot Expires
+      (type STRING SYMBOL)
+      (allowed-symbols nil)
+      (default nil))
+   (multislot History
+      (type STRING)))`)
+	})
+
+	t.Run("Insert and extract", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		data := ConvertedClass{
+			At:      when,
+			Timeout: time.Minute,
+			Addr:    net.ParseIP("10.0.0.1"),
+			History: []time.Time{when, when.Add(time.Hour)},
+		}
+		inst, err := env.Insert("conv", data)
+		assert.NilError(t, err)
+		assert.Equal(t, inst.String(), `[conv] of ConvertedClass (At "2020-01-02T03:04:05Z") (Timeout 60000000000) (Addr "10.0.0.1") (Expires nil) (History "2020-01-02T03:04:05Z" "2020-01-02T04:04:05Z")`)
+
+		var out ConvertedClass
+		err = inst.Extract(&out)
+		assert.NilError(t, err)
+		assert.Assert(t, out.At.Equal(when))
+		assert.Equal(t, out.Timeout, time.Minute)
+		assert.Assert(t, out.Addr.Equal(data.Addr))
+		assert.Assert(t, out.Expires == nil)
+		assert.Equal(t, len(out.History), 2)
+		assert.Assert(t, out.History[1].Equal(when.Add(time.Hour)))
+
+		expires := when.Add(24 * time.Hour)
+		data.Expires = &expires
+		inst, err = env.Insert("conv2", data)
+		assert.NilError(t, err)
+		err = inst.Extract(&out)
+		assert.NilError(t, err)
+		assert.Assert(t, out.Expires.Equal(expires))
+	})
+
+	t.Run("Assert struct", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		fact, err := env.AssertStruct(ConvertedClass{
+			At:   when,
+			Addr: net.ParseIP("10.0.0.2"),
+		})
+		assert.NilError(t, err)
+		at, err := fact.Slot("At")
+		assert.NilError(t, err)
+		assert.Equal(t, at, "2020-01-02T03:04:05Z")
+
+		var out ConvertedClass
+		err = fact.Extract(&out)
+		assert.NilError(t, err)
+		assert.Assert(t, out.At.Equal(when))
+		assert.Equal(t, out.Addr.String(), "10.0.0.2")
+	})
+
+	t.Run("Registered converter", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		registerCelsius(env)
+		type Reading struct {
+			Temp Celsius
+		}
+		inst, err := env.Insert("r", Reading{Temp: Celsius{21.5}})
+		assert.NilError(t, err)
+		assert.Equal(t, inst.String(), "[r] of Reading (Temp 21.5)")
+
+		var out Reading
+		err = inst.Extract(&out)
+		assert.NilError(t, err)
+		assert.Equal(t, out.Temp, Celsius{21.5})
+	})
+
+	t.Run("Callbacks", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		registerCelsius(env)
+		callback := func(temp Celsius, wait time.Duration) Celsius {
+			return Celsius{temp.Degrees + wait.Seconds()}
+		}
+		err := env.DefineFunction("warm", callback)
+		assert.NilError(t, err)
+
+		ret, err := env.Eval("(warm 20.0 2000000000)")
+		assert.NilError(t, err)
+		assert.Equal(t, ret, 22.0)
+	})
+
+	t.Run("Conversion error", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		var out time.Time
+		err := env.ExtractEval(&out, `"yesterday"`)
+		assert.ErrorContains(t, err, "cannot parse")
+
+		// the converter declares FLOAT, so an INTEGER from it is refused
+		env.RegisterConverter(reflect.TypeOf(Celsius{}), FLOAT, func(value interface{}) (interface{}, error) {
+			return int64(value.(Celsius).Degrees), nil
+		}, func(value interface{}) (interface{}, error) {
+			return Celsius{}, nil
+		})
+		_, err = env.Call("create$", Celsius{21})
+		assert.ErrorContains(t, err, `Invalid type "INTEGER" from converter, expected "FLOAT"`)
+	})
+}
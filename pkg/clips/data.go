@@ -118,8 +118,10 @@ import "C"
 */
 import (
 	"fmt"
+	"math"
 	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
 	"unsafe"
 )
@@ -130,6 +132,28 @@ type Symbol string
 // InstanceName represents a CLIPS INSTANCE_NAME value
 type InstanceName Symbol
 
+// OverflowPolicy determines how unsigned integers too large for a CLIPS INTEGER are stored
+type OverflowPolicy int
+
+const (
+	OVERFLOW_ERROR OverflowPolicy = iota
+	OVERFLOW_FLOAT
+	OVERFLOW_STRING
+)
+
+var clipsOverflowPolicies = [...]string{
+	"OVERFLOW_ERROR",
+	"OVERFLOW_FLOAT",
+	"OVERFLOW_STRING",
+}
+
+func (policy OverflowPolicy) String() string {
+	if policy < 0 || int(policy) >= len(clipsOverflowPolicies) {
+		return fmt.Sprintf("OverflowPolicy(%d)", policy)
+	}
+	return clipsOverflowPolicies[int(policy)]
+}
+
 // DataObject wraps a CLIPS data object
 type DataObject struct {
 	env  *Environment
@@ -184,14 +208,24 @@ func clipsTypeFor(typ reflect.Type) Type {
 	if typ == nil {
 		return SYMBOL
 	}
+	if typ.Kind() == reflect.Ptr {
+		switch typ {
+		case reflect.TypeOf((*ImpliedFact)(nil)), reflect.TypeOf((*TemplateFact)(nil)), reflect.TypeOf((*Instance)(nil)):
+		default:
+			// a pointer is represented by what it points to, or the nil symbol
+			typ = typ.Elem()
+		}
+	}
 	switch typ.Kind() {
 	case reflect.Bool:
 		return SYMBOL
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		return INTEGER
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return INTEGER
 	case reflect.Float32, reflect.Float64:
 		return FLOAT
-	case reflect.Array, reflect.Slice:
+	case reflect.Array, reflect.Slice, reflect.Map:
 		return MULTIFIELD
 	case reflect.Struct:
 		return INSTANCE_NAME
@@ -218,17 +252,118 @@ func clipsTypeFor(typ reflect.Type) Type {
 	return SYMBOL
 }
 
-// SetValue copies the go value into the dataobject
-func (do *DataObject) SetValue(value interface{}) {
+// SetValue copies the go value into the dataobject. An error is returned if the value can not be
+// represented in CLIPS, e.g. an unsigned integer too large for an INTEGER
+func (do *DataObject) SetValue(value interface{}) error {
+	value, err := do.env.clipsCompatible(value)
+	if err != nil {
+		return err
+	}
 	var dtype Type
 	if do.typ < 0 {
 		dtype = clipsTypeFor(reflect.TypeOf(value))
+		if isNilPointer(value) {
+			dtype = SYMBOL
+		}
 	} else {
 		dtype = do.typ
 	}
 
 	C.set_data_type(do.data, dtype.CVal())
 	C.set_data_value(do.data, do.clipsValue(value))
+	return nil
+}
+
+// canonicalValue returns value as it would be read back from CLIPS, e.g. an int64 for any Go integer
+func (env *Environment) canonicalValue(value interface{}) (interface{}, error) {
+	data := createDataObject(env)
+	defer data.Delete()
+	if err := data.SetValue(value); err != nil {
+		return nil, err
+	}
+	return data.Value(), nil
+}
+
+// sameValue returns true if two canonical values are equal, comparing facts and instances by identity
+func sameValue(a interface{}, b interface{}) bool {
+	switch av := a.(type) {
+	case Fact:
+		bv, ok := b.(Fact)
+		return ok && av.Equal(bv)
+	case *Instance:
+		bv, ok := b.(*Instance)
+		return ok && av.Equal(bv)
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for ii := range av {
+			if !sameValue(av[ii], bv[ii]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// clipsCompatible applies any converters to value, and checks that unsigned integers fit in a
+// CLIPS INTEGER, falling back according to the environment's overflow policy
+func (env *Environment) clipsCompatible(value interface{}) (interface{}, error) {
+	value, err := env.toCLIPS(value)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil || isNilPointer(value) {
+		return value, nil
+	}
+	switch value.(type) {
+	case unsafe.Pointer, []interface{}, *ImpliedFact, *TemplateFact, *Instance:
+		if list, ok := value.([]interface{}); ok {
+			return env.compatibleList(reflect.ValueOf(list))
+		}
+		return value, nil
+	}
+	val := reflect.ValueOf(value)
+	if val.Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+	switch val.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return env.unsignedValue(val.Uint())
+	case reflect.Slice, reflect.Array:
+		return env.compatibleList(val)
+	case reflect.Map:
+		return env.mapValue(val)
+	}
+	return value, nil
+}
+
+func (env *Environment) compatibleList(val reflect.Value) ([]interface{}, error) {
+	ret := make([]interface{}, val.Len())
+	for ii := 0; ii < val.Len(); ii++ {
+		v, err := env.clipsCompatible(val.Index(ii).Interface())
+		if err != nil {
+			return nil, err
+		}
+		ret[ii] = v
+	}
+	return ret, nil
+}
+
+// unsignedValue converts v to an INTEGER, or the fallback given by the overflow policy if it is too large
+func (env *Environment) unsignedValue(v uint64) (interface{}, error) {
+	if v <= math.MaxInt64 {
+		return int64(v), nil
+	}
+	switch env.overflow {
+	case OVERFLOW_FLOAT:
+		return float64(v), nil
+	case OVERFLOW_STRING:
+		return strconv.FormatUint(v, 10), nil
+	}
+	return nil, fmt.Errorf(`Unsigned integer %d too large for INTEGER`, v)
 }
 
 // goValue converts a CLIPS data value into a Go data structure
@@ -274,6 +409,11 @@ func (do *DataObject) clipsValue(dvalue interface{}) unsafe.Pointer {
 		defer C.free(unsafe.Pointer(vstr))
 		return C.EnvAddSymbol(do.env.env, vstr)
 	}
+	if isNilPointer(dvalue) {
+		vstr := C.CString(string(do.env.nilSymbol))
+		defer C.free(unsafe.Pointer(vstr))
+		return C.EnvAddSymbol(do.env.env, vstr)
+	}
 	switch v := dvalue.(type) {
 	case unsafe.Pointer:
 		return C.EnvAddExternalAddress(do.env.env, v, C.C_POINTER_EXTERNAL_ADDRESS)
@@ -310,9 +450,13 @@ func (do *DataObject) clipsValue(dvalue interface{}) unsafe.Pointer {
 		vstr := C.CString("FALSE")
 		defer C.free(unsafe.Pointer(vstr))
 		return C.EnvAddSymbol(do.env.env, vstr)
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		v := val.Int()
 		return C.EnvAddLong(do.env.env, C.longlong(v))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		// range is checked by clipsCompatible
+		v := val.Uint()
+		return C.EnvAddLong(do.env.env, C.longlong(v))
 	case reflect.Float32, reflect.Float64:
 		v := val.Float()
 		return C.EnvAddDouble(do.env.env, C.double(v))
@@ -347,6 +491,22 @@ func (do *DataObject) clipsValue(dvalue interface{}) unsafe.Pointer {
 	return C.EnvAddSymbol(do.env.env, vstr)
 }
 
+func isUnsigned(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+func isNilPointer(value interface{}) bool {
+	val := reflect.ValueOf(value)
+	return val.Kind() == reflect.Ptr && val.IsNil()
+}
+
 func (do *DataObject) multifieldToList() []interface{} {
 	end := C.get_data_end(do.data)
 	begin := C.get_data_begin(do.data)
@@ -366,7 +526,11 @@ func (do *DataObject) listToMultifield(values []interface{}) unsafe.Pointer {
 	ret := C.EnvCreateMultifield(do.env.env, size)
 	multifield := C.multifield_ptr(ret)
 	for i, v := range values {
-		C.set_multifield_type(multifield, C.long(i+1), C.short(clipsTypeFor(reflect.TypeOf(v))))
+		vtype := clipsTypeFor(reflect.TypeOf(v))
+		if isNilPointer(v) {
+			vtype = SYMBOL
+		}
+		C.set_multifield_type(multifield, C.long(i+1), C.short(vtype))
 		C.set_multifield_value(multifield, C.long(i+1), do.clipsValue(v))
 	}
 	C.set_data_begin(do.data, 1)
@@ -411,6 +575,28 @@ func safeIndirect(output reflect.Value) reflect.Value {
 }
 
 func (env *Environment) convertArg(output reflect.Value, data reflect.Value, extractClasses bool, knownInstances map[InstanceName]interface{}) error {
+	if env.isNilData(data) && output.Kind() == reflect.Ptr {
+		// optional values go back to being nil pointers
+		if output.CanSet() {
+			output.Set(reflect.Zero(output.Type()))
+			return nil
+		}
+		if !output.IsNil() && output.Elem().Kind() == reflect.Ptr {
+			output.Elem().Set(reflect.Zero(output.Elem().Type()))
+			return nil
+		}
+	}
+	if data.IsValid() {
+		target := output
+		if !target.CanSet() && target.Kind() == reflect.Ptr && !target.IsNil() {
+			target = target.Elem()
+		}
+		if target.CanSet() {
+			if converted, err := env.fromCLIPS(target, data); converted {
+				return err
+			}
+		}
+	}
 	val := safeIndirect(output)
 
 	if extractClasses && data.IsValid() {
@@ -438,8 +624,10 @@ func (env *Environment) convertArg(output reflect.Value, data reflect.Value, ext
 				} else {
 					if knownVal, ok := knownInstances[subinst.Name()]; ok {
 						// This implies a circular recursive reference
-						val.Set(reflect.ValueOf(knownVal).Elem())
+						setKnown(val, knownVal)
 						return nil
+					} else if typ, ok := env.registeredType(subinst.Class(), val.Type()); ok && val.Kind() == reflect.Interface {
+						return env.extractRegistered(val, subinst, typ, knownInstances)
 					} else {
 						// extract the instance
 						slots := subinst.Slots(true)
@@ -451,6 +639,23 @@ func (env *Environment) convertArg(output reflect.Value, data reflect.Value, ext
 		}
 	}
 
+	if data.IsValid() && !data.Type().AssignableTo(val.Type()) {
+		if fact, ok := data.Interface().(Fact); ok {
+			// a nested fact, as asserted by AssertStruct
+			target := val
+			if target.Kind() == reflect.Ptr && target.Type().Elem().Kind() == reflect.Struct {
+				target = safeIndirect(target)
+			}
+			if target.Kind() == reflect.Struct {
+				slots, err := fact.Slots()
+				if err != nil {
+					return err
+				}
+				return env.structuredExtract(target.Addr().Interface(), slots, extractClasses, knownInstances)
+			}
+		}
+	}
+
 	if !data.IsValid() {
 		switch val.Kind() {
 		case reflect.Ptr, reflect.Interface, reflect.Slice:
@@ -466,7 +671,7 @@ func (env *Environment) convertArg(output reflect.Value, data reflect.Value, ext
 		checktype = checktype.Elem()
 	}
 
-	if data.Type().AssignableTo(checktype) {
+	if data.Type().AssignableTo(checktype) && !env.polymorphicList(data, checktype, extractClasses) {
 		if val.Kind() == reflect.Ptr && data.Kind() != reflect.Ptr {
 			val = safeIndirect(val)
 		}
@@ -474,39 +679,53 @@ func (env *Environment) convertArg(output reflect.Value, data reflect.Value, ext
 		return nil
 	}
 
+	if data.Kind() == reflect.Slice && val.Kind() == reflect.Map {
+		list := make([]interface{}, data.Len())
+		for ii := range list {
+			list[ii] = data.Index(ii).Interface()
+		}
+		return env.extractMap(val, list, extractClasses, knownInstances)
+	}
+
 	if data.Kind() == reflect.Int64 {
 		// Make an exception when it's just loss of scale, and make it work
 		val = safeIndirect(val)
 		intval := data.Int()
-		var checkval int64
 		switch val.Type().Kind() {
-		case reflect.Int64:
-			// no check needed
-		case reflect.Int:
-			checkval = int64(int(intval))
-		case reflect.Int32:
-			checkval = int64(int32(intval))
-		case reflect.Int16:
-			checkval = int64(int16(intval))
-		case reflect.Int8:
-			checkval = int64(int8(intval))
-		case reflect.Uint:
-			checkval = int64(uint(intval))
-		case reflect.Uint64:
-			checkval = int64(uint64(intval))
-		case reflect.Uint32:
-			checkval = int64(uint32(intval))
-		case reflect.Uint16:
-			checkval = int64(uint16(intval))
-		case reflect.Uint8:
-			checkval = int64(uint8(intval))
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if val.OverflowInt(intval) {
+				return fmt.Errorf(`Integer %d too large`, intval)
+			}
+			val.SetInt(intval)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if intval < 0 {
+				return fmt.Errorf(`Integer %d negative for unsigned type "%v"`, intval, val.Type())
+			}
+			if val.OverflowUint(uint64(intval)) {
+				return fmt.Errorf(`Integer %d too large`, intval)
+			}
+			val.SetUint(uint64(intval))
 		default:
 			return fmt.Errorf(`Invalid type "%v", expected "%v"`, data.Type(), val.Type())
 		}
-		if checkval != intval {
-			return fmt.Errorf(`Integer %d too large`, intval)
+		return nil
+	} else if data.Kind() == reflect.Float64 && isUnsigned(val.Type()) {
+		// an unsigned integer stored as a FLOAT because it was too large for an INTEGER
+		val = safeIndirect(val)
+		floatval := data.Float()
+		if floatval < 0 || floatval != math.Trunc(floatval) || floatval >= math.MaxUint64 || val.OverflowUint(uint64(floatval)) {
+			return fmt.Errorf(`Floating point %f not representable as "%v"`, floatval, val.Type())
+		}
+		val.SetUint(uint64(floatval))
+		return nil
+	} else if data.Kind() == reflect.String && isUnsigned(val.Type()) {
+		// an unsigned integer stored as a STRING because it was too large for an INTEGER
+		val = safeIndirect(val)
+		uintval, err := strconv.ParseUint(data.String(), 10, val.Type().Bits())
+		if err != nil {
+			return fmt.Errorf(`Unable to convert "%s" to "%v": %v`, data.String(), val.Type(), err)
 		}
-		val.SetInt(checkval)
+		val.SetUint(uintval)
 		return nil
 	} else if data.Kind() == reflect.Float64 {
 		val = safeIndirect(val)
@@ -568,6 +787,15 @@ func (env *Environment) convertArg(output reflect.Value, data reflect.Value, ext
 	return fmt.Errorf(`Invalid type "%v", expected "%v"`, data.Type(), val.Type())
 }
 
+// isNilData returns true if data is nil or the symbol representing a nil pointer
+func (env *Environment) isNilData(data reflect.Value) bool {
+	if !data.IsValid() {
+		return true
+	}
+	sym, ok := data.Interface().(Symbol)
+	return ok && sym == env.nilSymbol
+}
+
 func (env *Environment) structuredExtract(retval interface{}, slots map[string]interface{}, extractClasses bool, knownInstances map[InstanceName]interface{}) error {
 	ptr := reflect.ValueOf(retval)
 	if ptr.Kind() != reflect.Ptr {
@@ -623,34 +851,66 @@ func (env *Environment) structuredExtract(retval interface{}, slots map[string]i
 }
 
 func (env *Environment) fillStruct(fieldval reflect.Value, field reflect.StructField, slots map[string]interface{}, extractClasses bool, knownInstances map[InstanceName]interface{}) error {
-	if field.Anonymous {
-		embedType := fieldval.Type()
+	if embedType, ok := embeddedStruct(field); ok {
+		if fieldval.Kind() == reflect.Ptr {
+			if fieldval.IsNil() {
+				fieldval.Set(reflect.New(embedType))
+			}
+			fieldval = fieldval.Elem()
+		}
 		// treat fields of the anonymous class just like they are native
 		for ii := 0; ii < fieldval.NumField(); ii++ {
 			if err := env.fillStruct(fieldval.Field(ii), embedType.Field(ii), slots, extractClasses, knownInstances); err != nil {
 				return err
 			}
 		}
+		return nil
 	}
 
-	fielddata, ok := slots[slotNameFor(field)]
-	if !ok {
+	tag := slotTagFor(field)
+	if tag.omit {
 		return nil
 	}
+	fielddata, ok := slots[tag.name]
+	if !ok {
+		if tag.hasDefault {
+			defval, err := tag.defaultValue(env, field.Type)
+			if err != nil {
+				return err
+			}
+			return env.convertArg(fieldval.Addr(), reflect.ValueOf(defval), extractClasses, knownInstances)
+		}
+		return env.fillFlattened(fieldval, field, slots, extractClasses, knownInstances)
+	}
+	if err := tag.check(fielddata); err != nil {
+		return err
+	}
 	return env.convertArg(fieldval.Addr(), reflect.ValueOf(fielddata), extractClasses, knownInstances)
 }
 
-// decide the CLIPS slot name based on tag
-func slotNameFor(field reflect.StructField) string {
-	if tag, ok := field.Tag.Lookup("clips"); ok {
-		return tag
+// fillFlattened fills a struct field from slots named "Field.Subfield", as asserted by AssertStruct with FlattenNestedStructs
+func (env *Environment) fillFlattened(fieldval reflect.Value, field reflect.StructField, slots map[string]interface{}, extractClasses bool, knownInstances map[InstanceName]interface{}) error {
+	fieldtype := field.Type
+	if fieldtype.Kind() == reflect.Ptr {
+		fieldtype = fieldtype.Elem()
+	}
+	if fieldtype.Kind() != reflect.Struct {
+		return nil
 	}
-	var ret = field.Name
-	if tag, ok := field.Tag.Lookup("json"); ok {
-		ret = strings.Split(tag, ",")[0]
+	prefix := slotNameFor(field) + "."
+	subslots := make(map[string]interface{})
+	for k, v := range slots {
+		if strings.HasPrefix(k, prefix) {
+			subslots[k[len(prefix):]] = v
+		}
 	}
-	if ret == "name" {
-		ret = "_name"
+	if len(subslots) == 0 {
+		return nil
 	}
-	return ret
+	return env.structuredExtract(fieldval.Addr().Interface(), subslots, extractClasses, knownInstances)
+}
+
+// decide the CLIPS slot name based on tag
+func slotNameFor(field reflect.StructField) string {
+	return slotTagFor(field).name
 }
@@ -15,6 +15,7 @@ package clips
 
 import (
 	"fmt"
+	"math"
 	"reflect"
 	"testing"
 	"unsafe"
@@ -713,3 +714,263 @@ func TestDataIntoClips(t *testing.T) {
 		assert.Equal(t, inst.String(), "[foo] of Foo (bar 12) (baz)")
 	})
 }
+
+func TestNilPointers(t *testing.T) {
+	type Optional struct {
+		Count *int
+		Label *string
+		Flag  *bool
+	}
+
+	t.Run("Insert class", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		cls, err := env.InsertClass((*Optional)(nil))
+		assert.NilError(t, err)
+		assert.Equal(t, cls.String(), `(defclass MAIN::Optional
+   (is-a USER)
+   (slot Count
+      (type INTEGER SYMBOL)
+      (allowed-symbols nil)
+      (default nil))
+   (slot Label
+      (type STRING SYMBOL)
+      (allowed-symbols nil)
+      (default nil))
+   (slot Flag
+      (type SYMBOL)))`)
+	})
+
+	t.Run("Insert and extract instance", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		inst, err := env.Insert("", Optional{})
+		assert.NilError(t, err)
+		assert.Equal(t, inst.String(), `[gen1] of Optional (Count nil) (Label nil) (Flag nil)`)
+
+		count := 3
+		out := Optional{
+			Count: &count,
+		}
+		err = inst.Extract(&out)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, out, Optional{})
+
+		label := "set"
+		inst, err = env.Insert("", Optional{
+			Count: &count,
+			Label: &label,
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, inst.String(), `[gen2] of Optional (Count 3) (Label "set") (Flag nil)`)
+	})
+
+	t.Run("Assert and extract fact", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		fact, err := env.AssertStruct(Optional{})
+		assert.NilError(t, err)
+		assert.Equal(t, fact.String(), `(Optional (Count nil) (Label nil) (Flag nil))`)
+
+		count := 3
+		out := Optional{
+			Count: &count,
+		}
+		err = fact.Extract(&out)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, out, Optional{})
+	})
+
+	t.Run("Custom sentinel", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		env.SetNilSymbol("none")
+		assert.Equal(t, env.NilSymbol(), Symbol("none"))
+
+		inst, err := env.Insert("", Optional{})
+		assert.NilError(t, err)
+		assert.Equal(t, inst.String(), `[gen1] of Optional (Count none) (Label none) (Flag none)`)
+
+		count := 3
+		out := Optional{
+			Count: &count,
+		}
+		err = inst.Extract(&out)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, out, Optional{})
+	})
+
+	t.Run("Globals", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(defglobal ?*count* = 1)")
+		assert.NilError(t, err)
+		glob, err := env.FindGlobal("count")
+		assert.NilError(t, err)
+
+		var count *int
+		err = glob.SetValue(count)
+		assert.NilError(t, err)
+		ret, err := glob.Value()
+		assert.NilError(t, err)
+		assert.Equal(t, ret, nil)
+
+		val := 5
+		err = glob.SetValue(&val)
+		assert.NilError(t, err)
+		ret, err = glob.Value()
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(5))
+	})
+
+	t.Run("Callbacks", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		callback := func(in *int) *int {
+			if in == nil {
+				return nil
+			}
+			ret := *in + 1
+			return &ret
+		}
+		err := env.DefineFunction("increment", callback)
+		assert.NilError(t, err)
+
+		ret, err := env.Eval("(increment 1)")
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(2))
+
+		ret, err = env.Eval("(increment nil)")
+		assert.NilError(t, err)
+		assert.Equal(t, ret, nil)
+	})
+}
+
+func TestUnsignedValues(t *testing.T) {
+	type Counter struct {
+		Small uint8
+		Big   uint64
+	}
+
+	t.Run("Checked conversion", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		ret, err := env.Call("+", uint8(200), uint32(4000000000))
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(4000000200))
+
+		ret, err = env.Call("create$", []uint16{1, 2})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, ret, []interface{}{int64(1), int64(2)})
+
+		_, err = env.Call("+", uint64(math.MaxUint64), 1)
+		assert.ErrorContains(t, err, "too large for INTEGER")
+	})
+
+	t.Run("Global overflow", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(defglobal ?*count* = 0)")
+		assert.NilError(t, err)
+		glb, err := env.FindGlobal("count")
+		assert.NilError(t, err)
+
+		err = glb.SetValue(uint64(math.MaxUint64))
+		assert.ErrorContains(t, err, "too large for INTEGER")
+
+		env.SetOverflowPolicy(OVERFLOW_STRING)
+		assert.Equal(t, env.OverflowPolicy(), OVERFLOW_STRING)
+		assert.Equal(t, env.OverflowPolicy().String(), "OVERFLOW_STRING")
+		assert.Equal(t, OverflowPolicy(3).String(), "OverflowPolicy(3)")
+		err = glb.SetValue(uint64(math.MaxUint64))
+		assert.NilError(t, err)
+		ret, err := glb.Value()
+		assert.NilError(t, err)
+		assert.Equal(t, ret, "18446744073709551615")
+
+		var out uint64
+		err = env.ExtractEval(&out, "?*count*")
+		assert.NilError(t, err)
+		assert.Equal(t, out, uint64(math.MaxUint64))
+	})
+
+	t.Run("Instance overflow", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := env.Insert("c", Counter{Small: 1, Big: math.MaxUint64})
+		assert.ErrorContains(t, err, `Unable to set slot "Big"`)
+	})
+
+	t.Run("Instance overflow fallback", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		env.SetOverflowPolicy(OVERFLOW_FLOAT)
+		cls, err := env.InsertClass((*Counter)(nil))
+		assert.NilError(t, err)
+		assert.Equal(t, cls.String(), `(defclass MAIN::Counter
+   (is-a USER)
+   (slot Small
+      (type INTEGER))
+   (slot Big
+      (type INTEGER FLOAT)))`)
+
+		inst, err := env.Insert("c", Counter{Small: 1, Big: 1 << 63})
+		assert.NilError(t, err)
+		big, err := inst.Slot("Big")
+		assert.NilError(t, err)
+		assert.Equal(t, big, float64(1<<63))
+
+		var out Counter
+		err = inst.Extract(&out)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, out, Counter{Small: 1, Big: 1 << 63})
+	})
+
+	t.Run("Extract range", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		var small uint8
+		err := env.ExtractEval(&small, "255")
+		assert.NilError(t, err)
+		assert.Equal(t, small, uint8(255))
+
+		err = env.ExtractEval(&small, "256")
+		assert.ErrorContains(t, err, "too large")
+
+		err = env.ExtractEval(&small, "-1")
+		assert.ErrorContains(t, err, "negative")
+	})
+
+	t.Run("Callback return", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.DefineFunction("big", func() uint64 {
+			return math.MaxUint64
+		})
+		assert.NilError(t, err)
+		_, err = env.Eval("(big)")
+		assert.ErrorContains(t, err, "too large for INTEGER")
+		_, err = env.Call("big")
+		assert.ErrorContains(t, err, "too large for INTEGER")
+
+		err = env.DefineFunction("small", func() uint16 {
+			return 65535
+		})
+		assert.NilError(t, err)
+		ret, err := env.Eval("(small)")
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(65535))
+	})
+}
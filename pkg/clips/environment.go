@@ -35,6 +35,8 @@ import (
 	"reflect"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"unsafe"
 )
 
@@ -45,40 +47,127 @@ const defFunction = `
 
 // Environment stores a CLIPS environment
 type Environment struct {
+	id       int
 	env      unsafe.Pointer
 	callback map[string]reflect.Value
 	router   map[string]Router
 	errRtr   *ErrorRouter
+	bound    map[*Instance]struct{}
+	// errors from refreshing bound instances after a Run
+	refreshErrs []error
+	// interfaces that have been inserted as abstract classes, by class name
+	interfaces map[string]reflect.Type
+	nilSymbol  Symbol
+	converters map[reflect.Type]*Converter
+	overflow   OverflowPolicy
+	mapMode    MapMode
+	types      map[string]reflect.Type
+	// compiled queries and the visitors of those running
+	queryCount   int
+	factVisitors []func(Fact) bool
+	// deffunctions built on demand, by parameters and body
+	generated map[string]string
+	// MAP-ENTRY instances made while an instance slot is being set
+	newEntries *[]*Instance
+	// lookups cached while asserting or inserting a batch
+	batch *batchCache
+	// records of the firings making facts and instances, if tracking is on
+	provenance *provenanceTracker
+	// how many facts and instances provenance is kept for, or 0 for the default
+	provenanceLimit int
+	// facts waiting to be retracted once their time to live has passed
+	expiry *expirySweeper
+	// the stream running over the environment, if any
+	stream *Stream
 }
 
 var environmentObj = make(map[unsafe.Pointer]*Environment)
 
+// environmentLock guards environmentObj, which callbacks read from whichever goroutine is running
+// CLIPS, such as that of a Stream
+var environmentLock sync.RWMutex
+
+// environmentFor returns the environment a callback came from
+func environmentFor(envptr unsafe.Pointer) (*Environment, bool) {
+	environmentLock.RLock()
+	defer environmentLock.RUnlock()
+	env, ok := environmentObj[envptr]
+	return env, ok
+}
+
+var environmentCount int32
+
 // CreateEnvironment creates a new instance of a CLIPS environment
 func CreateEnvironment() *Environment {
 	ret := &Environment{
+		id:       int(atomic.AddInt32(&environmentCount, 1)),
 		env:      C.CreateEnvironment(),
 		callback: make(map[string]reflect.Value),
 		router:   make(map[string]Router),
+		bound:    make(map[*Instance]struct{}),
+
+		interfaces: make(map[string]reflect.Type),
+		nilSymbol:  "nil",
+		converters: make(map[reflect.Type]*Converter),
+		types:      make(map[string]reflect.Type),
+
+		generated: make(map[string]string),
 	}
+	ret.registerBuiltinConverters()
 	ret.errRtr = CreateErrorRouter(ret)
 	runtime.SetFinalizer(ret, func(env *Environment) {
 		env.Delete()
 	})
 	C.define_function(ret.env)
+	environmentLock.Lock()
 	environmentObj[ret.env] = ret
+	environmentLock.Unlock()
 
 	return ret
 }
 
-// Delete destroys the CLIPS environment
+// SetNilSymbol sets the symbol used to represent a nil pointer in CLIPS. The default is nil
+func (env *Environment) SetNilSymbol(sym Symbol) {
+	env.nilSymbol = sym
+}
+
+// NilSymbol returns the symbol used to represent a nil pointer in CLIPS
+func (env *Environment) NilSymbol() Symbol {
+	return env.nilSymbol
+}
+
+// SetOverflowPolicy sets how unsigned integers too large for a CLIPS INTEGER are stored. The
+// default is OVERFLOW_ERROR, which makes the conversion fail
+func (env *Environment) SetOverflowPolicy(policy OverflowPolicy) {
+	env.overflow = policy
+}
+
+// OverflowPolicy returns how unsigned integers too large for a CLIPS INTEGER are stored
+func (env *Environment) OverflowPolicy() OverflowPolicy {
+	return env.overflow
+}
+
+// Delete destroys the CLIPS environment, first stopping its stream if one is running
 func (env *Environment) Delete() {
+	if env.stream != nil {
+		env.stream.cancel()
+		<-env.stream.done
+		env.stream = nil
+	}
 	if env.env != nil {
+		environmentLock.Lock()
 		delete(environmentObj, env.env)
+		environmentLock.Unlock()
 		C.DestroyEnvironment(env.env)
 		env.env = nil
 	}
 }
 
+// ID returns a number uniquely identifying this environment within the process
+func (env *Environment) ID() int {
+	return env.id
+}
+
 // Load loads a set of constructs into the CLIPS data base. Constructs can be in text or binary format. Equivalent to CLIPS (load)
 func (env *Environment) Load(path string) error {
 	cpath := C.CString(path)
@@ -5,6 +5,7 @@ package clips
 // #include <clips/clips.h>
 import "C"
 import (
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -27,6 +28,10 @@ import (
    limitations under the License.
 */
 
+// ErrStale is returned when a fact or instance handle is used after the fact has been retracted,
+// the instance deleted, the handle dropped or its environment deleted
+var ErrStale = errors.New("Fact or instance is no longer valid")
+
 // Error error returned from CLIPS
 type Error struct {
 	Err  error
@@ -0,0 +1,308 @@
+package clips
+
+// #cgo CFLAGS: -I ../../clips_source
+// #cgo LDFLAGS: -L ../../clips_source -l clips -lm
+// #include <clips/clips.h>
+//
+// void expiryRunFunction(void *env);
+// void expiryResetFunction(void *env, int clear);
+// void *last_fact(void *env);
+//
+// void *previous_fact(void *fact)
+// {
+//   return ((struct fact *)fact)->previousFact;
+// }
+//
+// void expiry_reset(void *env)
+// {
+//   expiryResetFunction(env, 0);
+// }
+//
+// void expiry_clear(void *env)
+// {
+//   expiryResetFunction(env, 1);
+// }
+//
+// void add_expiry_functions(void *env)
+// {
+//   EnvAddRunFunction(env, "go-expiry", expiryRunFunction, 0);
+//   EnvAddResetFunction(env, "go-expiry", expiry_reset, 0);
+//   EnvAddClearFunction(env, "go-expiry", expiry_clear, 0);
+// }
+import "C"
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"container/heap"
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+// expirySweeper retracts facts once their time to live has passed
+type expirySweeper struct {
+	now func() time.Time
+	// expiry policies by deftemplate
+	templates map[unsafe.Pointer]time.Duration
+	records   map[int]*expiryRecord
+	queue     expiryQueue
+	// index of the last fact checked against the template expiry policies
+	seen int
+	// the last error from a sweep made by Run or a rule firing
+	err error
+}
+
+type expiryRecord struct {
+	fact    Fact
+	expires time.Time
+	pos     int
+}
+
+// expiryQueue is a heap of records, soonest to expire first
+type expiryQueue []*expiryRecord
+
+func (q expiryQueue) Len() int {
+	return len(q)
+}
+
+func (q expiryQueue) Less(i, j int) bool {
+	if q[i].expires.Equal(q[j].expires) {
+		return q[i].fact.Index() < q[j].fact.Index()
+	}
+	return q[i].expires.Before(q[j].expires)
+}
+
+func (q expiryQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].pos = i
+	q[j].pos = j
+}
+
+func (q *expiryQueue) Push(x interface{}) {
+	rec := x.(*expiryRecord)
+	rec.pos = len(*q)
+	*q = append(*q, rec)
+}
+
+func (q *expiryQueue) Pop() interface{} {
+	old := *q
+	rec := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return rec
+}
+
+// SetClock sets the function giving the current time for fact expiry, so that tests need not wait
+// for facts to expire. Passing nil restores time.Now
+func (env *Environment) SetClock(now func() time.Time) {
+	if now == nil {
+		now = time.Now
+	}
+	env.expirySweeper().now = now
+}
+
+// AssertWithTTL asserts the fact, unless it already has been, and retracts it once ttl has passed.
+// Expired facts are retracted as usual, so rules matching them react, by Run before it starts and
+// after each rule firing, or by SweepExpired. Asserting an already expiring fact sets a new TTL
+func (env *Environment) AssertWithTTL(fact Fact, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("TTL must be positive, got %v", ttl)
+	}
+	if !fact.Asserted() {
+		if err := fact.Assert(); err != nil {
+			return err
+		}
+	}
+	// keep a handle of our own, so the fact expires even if the caller drops theirs
+	var factptr unsafe.Pointer
+	switch v := fact.(type) {
+	case *TemplateFact:
+		factptr = v.factptr
+	case *ImpliedFact:
+		factptr = v.factptr
+	default:
+		return fmt.Errorf("Unable to expire fact of type %T", fact)
+	}
+	sweeper := env.expirySweeper()
+	sweeper.expire(env.newFact(factptr), sweeper.now().Add(ttl))
+	return nil
+}
+
+// Expires returns when the fact is due to be retracted, and false if it has no TTL
+func (env *Environment) Expires(fact Fact) (time.Time, bool) {
+	if env.expiry == nil {
+		return time.Time{}, false
+	}
+	rec, ok := env.expiry.records[fact.Index()]
+	if !ok || !rec.fact.Equal(fact) {
+		return time.Time{}, false
+	}
+	return rec.expires, true
+}
+
+// SweepExpired retracts the facts whose TTL has passed, soonest first, returning how many were
+// retracted
+func (env *Environment) SweepExpired() (int, error) {
+	if env.expiry == nil {
+		return 0, nil
+	}
+	return env.expiry.sweep(env)
+}
+
+// ExpiryError returns the last error from retracting expired facts before a Run or after a rule
+// firing, where it can't be returned, and clears it. It returns nil if there was none
+func (env *Environment) ExpiryError() error {
+	if env.expiry == nil {
+		return nil
+	}
+	err := env.expiry.err
+	env.expiry.err = nil
+	return err
+}
+
+// SetExpiry gives every fact of this template a time to live, as if asserted by AssertWithTTL.
+// The TTL of a fact is counted from when the sweeper first sees it: the next rule firing or call
+// to Run or SweepExpired after it is asserted. A ttl of 0 removes the policy, though facts already
+// seen keep their expiry
+func (t *Template) SetExpiry(ttl time.Duration) {
+	sweeper := t.env.expirySweeper()
+	if ttl <= 0 {
+		delete(sweeper.templates, t.tplptr)
+		return
+	}
+	sweeper.templates[t.tplptr] = ttl
+}
+
+// Expiry returns the time to live given to facts of this template, or 0 if they have none
+func (t *Template) Expiry() time.Duration {
+	if t.env.expiry == nil {
+		return 0
+	}
+	return t.env.expiry.templates[t.tplptr]
+}
+
+// expirySweeper returns the sweeper of the environment, creating it on first use
+func (env *Environment) expirySweeper() *expirySweeper {
+	if env.expiry == nil {
+		env.expiry = &expirySweeper{
+			now:       time.Now,
+			templates: make(map[unsafe.Pointer]time.Duration),
+			records:   make(map[int]*expiryRecord),
+		}
+		C.add_expiry_functions(env.env)
+	}
+	return env.expiry
+}
+
+// expire records when the fact expires, taking over the handle
+func (s *expirySweeper) expire(fact Fact, expires time.Time) {
+	if rec, ok := s.records[fact.Index()]; ok {
+		if rec.fact.Equal(fact) {
+			rec.expires = expires
+			heap.Fix(&s.queue, rec.pos)
+			fact.Drop()
+			return
+		}
+		s.remove(rec)
+	}
+	rec := &expiryRecord{
+		fact:    fact,
+		expires: expires,
+	}
+	s.records[fact.Index()] = rec
+	heap.Push(&s.queue, rec)
+}
+
+func (s *expirySweeper) remove(rec *expiryRecord) {
+	heap.Remove(&s.queue, rec.pos)
+	delete(s.records, rec.fact.Index())
+	rec.fact.Drop()
+}
+
+// sweep gives facts of templates with an expiry policy their TTL, then retracts expired facts
+func (s *expirySweeper) sweep(env *Environment) (int, error) {
+	now := s.now()
+	if len(s.templates) > 0 {
+		s.stamp(env, now)
+	}
+	count := 0
+	for len(s.queue) > 0 {
+		rec := s.queue[0]
+		if !rec.fact.Asserted() {
+			// retracted some other way
+			heap.Pop(&s.queue)
+			delete(s.records, rec.fact.Index())
+			rec.fact.Drop()
+			continue
+		}
+		if now.Before(rec.expires) {
+			break
+		}
+		err := rec.fact.Retract()
+		s.remove(rec)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// sweepAndRecord sweeps, keeping any error for ExpiryError
+func (s *expirySweeper) sweepAndRecord(env *Environment) {
+	if _, err := s.sweep(env); err != nil {
+		s.err = err
+	}
+}
+
+// stamp walks back over the facts asserted since the last sweep, giving those of templates with
+// an expiry policy their TTL
+func (s *expirySweeper) stamp(env *Environment, now time.Time) {
+	factptr := C.last_fact(env.env)
+	if factptr == nil {
+		return
+	}
+	last := int(C.EnvFactIndex(env.env, factptr))
+	for ; factptr != nil; factptr = C.previous_fact(factptr) {
+		if int(C.EnvFactIndex(env.env, factptr)) <= s.seen {
+			break
+		}
+		ttl, ok := s.templates[C.EnvFactDeftemplate(env.env, factptr)]
+		if !ok {
+			continue
+		}
+		fact := env.newFact(factptr)
+		if rec, ok := s.records[fact.Index()]; ok && rec.fact.Equal(fact) {
+			// already given a TTL by AssertWithTTL
+			fact.Drop()
+			continue
+		}
+		s.expire(fact, now.Add(ttl))
+	}
+	s.seen = last
+}
+
+// reset forgets the facts removed by a reset or clear; a clear also removes the template policies
+func (s *expirySweeper) reset(clear bool) {
+	for _, rec := range s.queue {
+		rec.fact.Drop()
+	}
+	s.queue = nil
+	s.records = make(map[int]*expiryRecord)
+	s.seen = 0
+	if clear {
+		s.templates = make(map[unsafe.Pointer]time.Duration)
+	}
+}
@@ -0,0 +1,42 @@
+package clips
+
+// #cgo CFLAGS: -I ../../clips_source
+// #cgo LDFLAGS: -L ../../clips_source -l clips -lm
+// #include <clips/clips.h>
+import "C"
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"unsafe"
+)
+
+//export expiryRunFunction
+func expiryRunFunction(envptr unsafe.Pointer) {
+	env, ok := environmentFor(envptr)
+	if !ok || env.expiry == nil {
+		return
+	}
+	env.expiry.sweepAndRecord(env)
+}
+
+//export expiryResetFunction
+func expiryResetFunction(envptr unsafe.Pointer, clear C.int) {
+	env, ok := environmentFor(envptr)
+	if !ok || env.expiry == nil {
+		return
+	}
+	env.expiry.reset(clear == 1)
+}
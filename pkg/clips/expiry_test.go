@@ -0,0 +1,159 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestExpiry(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("AssertWithTTL", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		now := start
+		env.SetClock(func() time.Time { return now })
+		err := env.Build(`(defrule recent-reading (logical (reading ?x)) => (assert (recent ?x)))`)
+		assert.NilError(t, err)
+
+		tpl, err := env.FindTemplate("reading")
+		assert.NilError(t, err)
+		fact, err := tpl.NewFact()
+		assert.NilError(t, err)
+		err = fact.(*ImpliedFact).Append(1)
+		assert.NilError(t, err)
+		err = env.AssertWithTTL(fact, time.Minute)
+		assert.NilError(t, err)
+		assert.Assert(t, fact.Asserted())
+		expires, ok := env.Expires(fact)
+		assert.Assert(t, ok)
+		assert.Equal(t, expires, start.Add(time.Minute))
+
+		other, err := env.AssertString(`(reading 2)`)
+		assert.NilError(t, err)
+		err = env.AssertWithTTL(other, 2*time.Minute)
+		assert.NilError(t, err)
+		env.Run(-1)
+		count := len(env.Facts())
+
+		now = start.Add(time.Minute)
+		env.Run(-1)
+		assert.Assert(t, !fact.Asserted())
+		assert.Assert(t, other.Asserted())
+		// the logically supported fact goes with the expired one
+		assert.Equal(t, len(env.Facts()), count-2)
+
+		now = start.Add(3 * time.Minute)
+		retracted, err := env.SweepExpired()
+		assert.NilError(t, err)
+		assert.Equal(t, retracted, 1)
+		assert.Assert(t, !other.Asserted())
+
+		err = env.AssertWithTTL(other, 0)
+		assert.ErrorContains(t, err, "TTL must be positive")
+	})
+
+	t.Run("Template policy", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		now := start
+		env.SetClock(func() time.Time { return now })
+		err := env.Build(`(deftemplate event (slot id))`)
+		assert.NilError(t, err)
+		err = env.Build(`(defrule echo (event (id ?id)) => (assert (event (id (+ ?id 100)))))`)
+		assert.NilError(t, err)
+		tpl, err := env.FindTemplate("event")
+		assert.NilError(t, err)
+		tpl.SetExpiry(10 * time.Second)
+		assert.Equal(t, tpl.Expiry(), 10*time.Second)
+
+		event, err := env.AssertString(`(event (id 1))`)
+		assert.NilError(t, err)
+		env.Run(1)
+		expires, ok := env.Expires(event)
+		assert.Assert(t, ok)
+		assert.Equal(t, expires, start.Add(10*time.Second))
+		echo, err := env.FactByIndex(event.Index() + 1)
+		assert.NilError(t, err)
+		_, ok = env.Expires(echo)
+		assert.Assert(t, ok)
+
+		now = start.Add(10 * time.Second)
+		retracted, err := env.SweepExpired()
+		assert.NilError(t, err)
+		assert.Equal(t, retracted, 2)
+
+		tpl.SetExpiry(0)
+		assert.Equal(t, tpl.Expiry(), time.Duration(0))
+		event, err = env.AssertString(`(event (id 2))`)
+		assert.NilError(t, err)
+		now = start.Add(time.Hour)
+		_, err = env.SweepExpired()
+		assert.NilError(t, err)
+		assert.Assert(t, event.Asserted())
+	})
+
+	t.Run("Same name in another module", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		now := start
+		env.SetClock(func() time.Time { return now })
+		err := env.Build(`(deftemplate event (slot id))`)
+		assert.NilError(t, err)
+		tpl, err := env.FindTemplate("event")
+		assert.NilError(t, err)
+		tpl.SetExpiry(10 * time.Second)
+
+		err = env.Build(`(defmodule OTHER)`)
+		assert.NilError(t, err)
+		err = env.Build(`(deftemplate OTHER::event (slot id))`)
+		assert.NilError(t, err)
+		other, err := env.FindTemplate("OTHER::event")
+		assert.NilError(t, err)
+		assert.Equal(t, other.Expiry(), time.Duration(0))
+
+		event, err := env.AssertString(`(OTHER::event (id 1))`)
+		assert.NilError(t, err)
+		env.Run(-1)
+		assert.NilError(t, env.ExpiryError())
+		_, ok := env.Expires(event)
+		assert.Assert(t, !ok)
+		now = start.Add(time.Hour)
+		_, err = env.SweepExpired()
+		assert.NilError(t, err)
+		assert.Assert(t, event.Asserted())
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		fact, err := env.AssertString(`(reading 1)`)
+		assert.NilError(t, err)
+		err = env.AssertWithTTL(fact, time.Hour)
+		assert.NilError(t, err)
+		env.Reset()
+		assert.Equal(t, len(env.expiry.queue), 0)
+		_, ok := env.Expires(fact)
+		assert.Assert(t, !ok)
+	})
+}
@@ -0,0 +1,323 @@
+package clips
+
+// #cgo CFLAGS: -I ../../clips_source
+// #cgo LDFLAGS: -L ../../clips_source -l clips -lm
+// #include <clips/clips.h>
+import "C"
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unsafe"
+)
+
+const factVisitFunction = "clipsgo-fact-visit"
+
+// FactIterator steps through facts one at a time, without collecting them first. Facts must not
+// be retracted while iterating; collect them first if need be
+type FactIterator struct {
+	env     *Environment
+	tplptr  unsafe.Pointer
+	factptr unsafe.Pointer
+	where   func(map[string]interface{}) bool
+	current Fact
+	err     error
+	done    bool
+}
+
+// QueryFacts returns an iterator over the facts of the named template for which where returns
+// true. where is given the slot values of each fact, as returned by Fact.Slots(). If template is
+// "", all facts are considered, and if where is nil, every fact matches
+func (env *Environment) QueryFacts(template string, where func(map[string]interface{}) bool) (*FactIterator, error) {
+	ret := &FactIterator{
+		env:   env,
+		where: where,
+	}
+	if template != "" {
+		tpl, err := env.FindTemplate(template)
+		if err != nil {
+			return nil, err
+		}
+		ret.tplptr = tpl.tplptr
+	}
+	return ret, nil
+}
+
+// Next advances to the next matching fact, returning false when there are no more or an error
+// occurred. The previous fact is dropped, so a fact to be kept must be taken with Fact first
+func (it *FactIterator) Next() bool {
+	if it.done {
+		return false
+	}
+	for {
+		// the fact is held until the next is found, as it may be freed once dropped
+		var next unsafe.Pointer
+		if it.tplptr != nil {
+			next = C.EnvGetNextFactInTemplate(it.env.env, it.tplptr, it.factptr)
+		} else {
+			next = C.EnvGetNextFact(it.env.env, it.factptr)
+		}
+		it.dropCurrent()
+		it.factptr = next
+		if next == nil {
+			it.done = true
+			return false
+		}
+		it.current = it.env.newFact(next)
+		if it.where == nil {
+			return true
+		}
+		slots, err := it.current.Slots()
+		if err != nil {
+			it.dropCurrent()
+			it.err = err
+			it.done = true
+			return false
+		}
+		if it.where(slots) {
+			return true
+		}
+	}
+}
+
+// Fact returns the current fact. The iterator drops its own reference when it advances, so the
+// fact returned holds a reference of its own
+func (it *FactIterator) Fact() Fact {
+	if it.current == nil {
+		return nil
+	}
+	return it.env.newFact(it.factptr)
+}
+
+// Close ends the iteration early, dropping the current fact
+func (it *FactIterator) Close() {
+	it.dropCurrent()
+	it.done = true
+}
+
+func (it *FactIterator) dropCurrent() {
+	if it.current != nil {
+		it.current.Drop()
+		it.current = nil
+	}
+}
+
+// Err returns the error, if any, that ended the iteration
+func (it *FactIterator) Err() error {
+	return it.err
+}
+
+// Extract unmarshals the current fact into the user provided object
+func (it *FactIterator) Extract(retval interface{}) error {
+	if it.current == nil {
+		return fmt.Errorf("No current fact")
+	}
+	return it.current.Extract(retval)
+}
+
+// ExtractAll unmarshals all the remaining facts into retval, which must be a pointer to a slice.
+// The elements may be structs, pointers to structs, maps or Fact
+func (it *FactIterator) ExtractAll(retval interface{}) error {
+	slice, err := factSlice(retval)
+	if err != nil {
+		return err
+	}
+	for it.Next() {
+		fact := it.current
+		if reflect.TypeOf(fact).AssignableTo(slice.Type().Elem()) {
+			// the slice keeps the fact, so it takes the iterator's reference
+			it.current = nil
+		}
+		if err := appendFact(slice, fact); err != nil {
+			it.Close()
+			return err
+		}
+	}
+	return it.err
+}
+
+// factSlice checks that retval is a pointer to a slice, and empties the slice
+func factSlice(retval interface{}) (reflect.Value, error) {
+	ptr := reflect.ValueOf(retval)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() || ptr.Elem().Kind() != reflect.Slice {
+		return reflect.Value{}, fmt.Errorf("Unable to store facts to %T, expected a pointer to a slice", retval)
+	}
+	slice := ptr.Elem()
+	slice.Set(slice.Slice(0, 0))
+	return slice, nil
+}
+
+// appendFact extracts fact as a new element of slice
+func appendFact(slice reflect.Value, fact Fact) error {
+	elemType := slice.Type().Elem()
+	elem := reflect.New(elemType)
+	if reflect.TypeOf(fact).AssignableTo(elemType) {
+		elem.Elem().Set(reflect.ValueOf(fact))
+	} else if err := fact.Extract(elem.Interface()); err != nil {
+		return err
+	}
+	slice.Set(reflect.Append(slice, elem.Elem()))
+	return nil
+}
+
+// FactQuery is a query over the facts of a template, compiled to CLIPS deffunctions using
+// find-all-facts and do-for-all-facts, so that it can be run repeatedly with different parameters.
+// The deffunctions are built in the template's module
+type FactQuery struct {
+	env *Environment
+	// module-qualified name of the deffunction running the query
+	name   string
+	params []string
+}
+
+// CompileFactQuery compiles a query over the facts of template. query is a CLIPS expression in
+// which ?f is the fact being tested and each named parameter is a variable, e.g.
+//
+//	q, err := env.CompileFactQuery("person", "(>= ?f:age ?min)", "min")
+//
+// The values of the parameters are given as Go values when the query is run
+func (env *Environment) CompileFactQuery(template string, query string, params ...string) (*FactQuery, error) {
+	tpl, err := env.FindTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+	module := tpl.Module().Name()
+	env.queryCount++
+	ret := &FactQuery{
+		env:    env,
+		name:   fmt.Sprintf("%s::clipsgo-fact-query-%d", module, env.queryCount),
+		params: params,
+	}
+	vars := make([]string, len(params))
+	for ii, param := range params {
+		vars[ii] = "?" + strings.TrimPrefix(param, "?")
+	}
+	if err := env.defineFactVisitor(module); err != nil {
+		return nil, err
+	}
+	factset := fmt.Sprintf("((?f %s))", tpl.Name())
+	err = env.Build(fmt.Sprintf("(deffunction %s (%s) (find-all-facts %s %s))",
+		ret.name, strings.Join(vars, " "), factset, query))
+	if err != nil {
+		return nil, err
+	}
+	err = env.Build(fmt.Sprintf("(deffunction %s-each (%s) (do-for-all-facts %s %s (if (not (%s::%s ?f)) then (break))))",
+		ret.name, strings.Join(vars, " "), factset, query, module, factVisitFunction))
+	if err != nil {
+		ret.Delete()
+		return nil, err
+	}
+	return ret, nil
+}
+
+// defineFactVisitor defines the function in module through which the -each deffunctions hand each
+// fact to the innermost visitor given to Each. It must exist before they are built
+func (env *Environment) defineFactVisitor(module string) error {
+	name := module + "::" + factVisitFunction
+	if _, err := env.FindFunction(name); err == nil {
+		return nil
+	}
+	return env.DefineFunction(name, func(fact Fact) bool {
+		visitors := env.factVisitors
+		return visitors[len(visitors)-1](fact)
+	})
+}
+
+func (q *FactQuery) checkArgs(args []interface{}) error {
+	if len(args) != len(q.params) {
+		return fmt.Errorf("Query expects %d parameters, got %d", len(q.params), len(args))
+	}
+	return nil
+}
+
+// Find runs the query, returning all matching facts
+func (q *FactQuery) Find(args ...interface{}) ([]Fact, error) {
+	if err := q.checkArgs(args); err != nil {
+		return nil, err
+	}
+	ret, err := q.env.Call(q.name, args...)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := ret.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Unexpected result from query: %v", ret)
+	}
+	facts := make([]Fact, len(list))
+	for ii, v := range list {
+		if facts[ii], ok = v.(Fact); !ok {
+			return nil, fmt.Errorf("Unexpected result from query: %v", v)
+		}
+	}
+	return facts, nil
+}
+
+// Extract runs the query, unmarshaling all matching facts into retval, which must be a pointer
+// to a slice. The elements may be structs, pointers to structs, maps or Fact
+func (q *FactQuery) Extract(retval interface{}, args ...interface{}) error {
+	slice, err := factSlice(retval)
+	if err != nil {
+		return err
+	}
+	facts, err := q.Find(args...)
+	if err != nil {
+		return err
+	}
+	for _, fact := range facts {
+		if err := appendFact(slice, fact); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Each runs the query, calling visit for each matching fact as it is found rather than collecting
+// them first. The query stops early if visit returns false
+func (q *FactQuery) Each(visit func(Fact) bool, args ...interface{}) error {
+	if err := q.checkArgs(args); err != nil {
+		return err
+	}
+	if err := q.env.defineFactVisitor(q.module()); err != nil {
+		return err
+	}
+	q.env.factVisitors = append(q.env.factVisitors, visit)
+	defer func() {
+		q.env.factVisitors = q.env.factVisitors[:len(q.env.factVisitors)-1]
+	}()
+	_, err := q.env.Call(q.name+"-each", args...)
+	return err
+}
+
+// module returns the module the query's deffunctions are in
+func (q *FactQuery) module() string {
+	return q.name[:strings.Index(q.name, "::")]
+}
+
+// Delete removes the deffunctions the query was compiled to
+func (q *FactQuery) Delete() error {
+	for _, name := range []string{q.name + "-each", q.name} {
+		fn, err := q.env.FindFunction(name)
+		if err != nil {
+			continue
+		}
+		if err := fn.Undefine(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,372 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+type QueryPerson struct {
+	Name string `json:"name"`
+	Age  int    `clips:"age"`
+}
+
+func TestQueryFacts(t *testing.T) {
+	t.Run("Iterate", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(deftemplate person (slot name (type STRING)) (slot age (type INTEGER)))")
+		assert.NilError(t, err)
+		for _, fact := range []string{
+			`(person (name "alice") (age 40))`,
+			`(person (name "bob") (age 17))`,
+			`(person (name "carol") (age 65))`,
+			`(unrelated 1 2 3)`,
+		} {
+			_, err = env.AssertString(fact)
+			assert.NilError(t, err)
+		}
+
+		it, err := env.QueryFacts("person", func(slots map[string]interface{}) bool {
+			return slots["age"].(int64) >= 18
+		})
+		assert.NilError(t, err)
+
+		names := make([]string, 0)
+		for it.Next() {
+			var p QueryPerson
+			err = it.Extract(&p)
+			assert.NilError(t, err)
+			names = append(names, p.Name)
+		}
+		assert.NilError(t, it.Err())
+		assert.DeepEqual(t, names, []string{"alice", "carol"})
+		assert.Assert(t, !it.Next())
+	})
+
+	t.Run("All facts", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(deftemplate person (slot name (type STRING)) (slot age (type INTEGER)))")
+		assert.NilError(t, err)
+		for _, fact := range []string{
+			`(person (name "alice") (age 40))`,
+			`(person (name "bob") (age 17))`,
+			`(person (name "carol") (age 65))`,
+			`(unrelated 1 2 3)`,
+		} {
+			_, err = env.AssertString(fact)
+			assert.NilError(t, err)
+		}
+
+		it, err := env.QueryFacts("", nil)
+		assert.NilError(t, err)
+		var facts []Fact
+		err = it.ExtractAll(&facts)
+		assert.NilError(t, err)
+		// includes initial-fact
+		assert.Equal(t, len(facts), len(env.Facts()))
+	})
+
+	t.Run("Extract all", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(deftemplate person (slot name (type STRING)) (slot age (type INTEGER)))")
+		assert.NilError(t, err)
+		for _, fact := range []string{
+			`(person (name "alice") (age 40))`,
+			`(person (name "bob") (age 17))`,
+			`(person (name "carol") (age 65))`,
+			`(unrelated 1 2 3)`,
+		} {
+			_, err = env.AssertString(fact)
+			assert.NilError(t, err)
+		}
+
+		it, err := env.QueryFacts("person", func(slots map[string]interface{}) bool {
+			return slots["name"] != "bob"
+		})
+		assert.NilError(t, err)
+		var people []*QueryPerson
+		err = it.ExtractAll(&people)
+		assert.NilError(t, err)
+		assert.Equal(t, len(people), 2)
+		assert.DeepEqual(t, *people[1], QueryPerson{Name: "carol", Age: 65})
+
+		var bad QueryPerson
+		err = it.ExtractAll(&bad)
+		assert.ErrorContains(t, err, "expected a pointer to a slice")
+	})
+
+	t.Run("Facts dropped while iterating", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(deftemplate person (slot name (type STRING)) (slot age (type INTEGER)))")
+		assert.NilError(t, err)
+		for _, fact := range []string{
+			`(person (name "alice") (age 40))`,
+			`(person (name "bob") (age 17))`,
+			`(person (name "carol") (age 65))`,
+			`(unrelated 1 2 3)`,
+		} {
+			_, err = env.AssertString(fact)
+			assert.NilError(t, err)
+		}
+
+		people := env.Facts()[1:4]
+		before := make([]int, len(people))
+		for ii, fact := range people {
+			before[ii] = factBusyCount(fact.(*TemplateFact).factptr)
+		}
+
+		it, err := env.QueryFacts("person", nil)
+		assert.NilError(t, err)
+		for it.Next() {
+		}
+		for ii, fact := range people {
+			assert.Equal(t, factBusyCount(fact.(*TemplateFact).factptr), before[ii])
+		}
+
+		it, err = env.QueryFacts("person", nil)
+		assert.NilError(t, err)
+		assert.Assert(t, it.Next())
+		it.Close()
+		assert.Equal(t, factBusyCount(people[0].(*TemplateFact).factptr), before[0])
+		assert.Assert(t, !it.Next())
+	})
+
+	t.Run("Unknown template", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := env.QueryFacts("nosuch", nil)
+		assert.ErrorContains(t, err, "not found")
+	})
+}
+
+func TestFactQuery(t *testing.T) {
+	t.Run("Find", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(deftemplate person (slot name (type STRING)) (slot age (type INTEGER)))")
+		assert.NilError(t, err)
+		for _, fact := range []string{
+			`(person (name "alice") (age 40))`,
+			`(person (name "bob") (age 17))`,
+			`(person (name "carol") (age 65))`,
+			`(unrelated 1 2 3)`,
+		} {
+			_, err = env.AssertString(fact)
+			assert.NilError(t, err)
+		}
+
+		q, err := env.CompileFactQuery("person", "(>= ?f:age ?min)", "min")
+		assert.NilError(t, err)
+
+		facts, err := q.Find(18)
+		assert.NilError(t, err)
+		assert.Equal(t, len(facts), 2)
+
+		facts, err = q.Find(50)
+		assert.NilError(t, err)
+		assert.Equal(t, len(facts), 1)
+		name, err := facts[0].Slot("name")
+		assert.NilError(t, err)
+		assert.Equal(t, name, "carol")
+
+		_, err = q.Find()
+		assert.ErrorContains(t, err, "expects 1 parameters")
+	})
+
+	t.Run("Extract", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(deftemplate person (slot name (type STRING)) (slot age (type INTEGER)))")
+		assert.NilError(t, err)
+		for _, fact := range []string{
+			`(person (name "alice") (age 40))`,
+			`(person (name "bob") (age 17))`,
+			`(person (name "carol") (age 65))`,
+			`(unrelated 1 2 3)`,
+		} {
+			_, err = env.AssertString(fact)
+			assert.NilError(t, err)
+		}
+
+		q, err := env.CompileFactQuery("person", "(and (>= ?f:age ?min) (neq ?f:name ?skip))", "min", "skip")
+		assert.NilError(t, err)
+
+		var people []QueryPerson
+		err = q.Extract(&people, 0, "alice")
+		assert.NilError(t, err)
+		assert.DeepEqual(t, people, []QueryPerson{
+			{Name: "bob", Age: 17},
+			{Name: "carol", Age: 65},
+		})
+	})
+
+	t.Run("Each", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(deftemplate person (slot name (type STRING)) (slot age (type INTEGER)))")
+		assert.NilError(t, err)
+		for _, fact := range []string{
+			`(person (name "alice") (age 40))`,
+			`(person (name "bob") (age 17))`,
+			`(person (name "carol") (age 65))`,
+			`(unrelated 1 2 3)`,
+		} {
+			_, err = env.AssertString(fact)
+			assert.NilError(t, err)
+		}
+
+		q, err := env.CompileFactQuery("person", "(< ?f:age ?max)", "max")
+		assert.NilError(t, err)
+
+		var visited []string
+		err = q.Each(func(fact Fact) bool {
+			name, err := fact.Slot("name")
+			assert.NilError(t, err)
+			visited = append(visited, name.(string))
+			return true
+		}, 100)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, visited, []string{"alice", "bob", "carol"})
+
+		// stop early
+		visited = nil
+		err = q.Each(func(fact Fact) bool {
+			visited = append(visited, "x")
+			return false
+		}, 100)
+		assert.NilError(t, err)
+		assert.Equal(t, len(visited), 1)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(deftemplate person (slot name (type STRING)) (slot age (type INTEGER)))")
+		assert.NilError(t, err)
+		for _, fact := range []string{
+			`(person (name "alice") (age 40))`,
+			`(person (name "bob") (age 17))`,
+			`(person (name "carol") (age 65))`,
+			`(unrelated 1 2 3)`,
+		} {
+			_, err = env.AssertString(fact)
+			assert.NilError(t, err)
+		}
+
+		q, err := env.CompileFactQuery("person", "TRUE")
+		assert.NilError(t, err)
+		err = q.Delete()
+		assert.NilError(t, err)
+		_, err = q.Find()
+		assert.ErrorContains(t, err, "Unable to call function")
+	})
+
+	t.Run("Other current module", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(deftemplate person (slot name (type STRING)) (slot age (type INTEGER)))")
+		assert.NilError(t, err)
+		for _, fact := range []string{
+			`(person (name "alice") (age 40))`,
+			`(person (name "bob") (age 17))`,
+			`(person (name "carol") (age 65))`,
+			`(unrelated 1 2 3)`,
+		} {
+			_, err = env.AssertString(fact)
+			assert.NilError(t, err)
+		}
+
+		q, err := env.CompileFactQuery("person", "(>= ?f:age ?min)", "min")
+		assert.NilError(t, err)
+		err = env.Build("(defmodule OTHER)")
+		assert.NilError(t, err)
+		assert.Equal(t, env.CurrentModule().Name(), "OTHER")
+
+		facts, err := q.Find(18)
+		assert.NilError(t, err)
+		assert.Equal(t, len(facts), 2)
+
+		count := 0
+		err = q.Each(func(fact Fact) bool {
+			count++
+			return true
+		}, 18)
+		assert.NilError(t, err)
+		assert.Equal(t, count, 2)
+	})
+
+	t.Run("Template in another module", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(defmodule SENSORS)")
+		assert.NilError(t, err)
+		err = env.Build("(deftemplate SENSORS::reading (slot value (type INTEGER)))")
+		assert.NilError(t, err)
+		_, err = env.AssertString("(reading (value 5))")
+		assert.NilError(t, err)
+
+		q, err := env.CompileFactQuery("SENSORS::reading", "(> ?f:value ?min)", "min")
+		assert.NilError(t, err)
+		facts, err := q.Find(1)
+		assert.NilError(t, err)
+		assert.Equal(t, len(facts), 1)
+
+		count := 0
+		err = q.Each(func(fact Fact) bool {
+			count++
+			return true
+		}, 1)
+		assert.NilError(t, err)
+		assert.Equal(t, count, 1)
+		assert.NilError(t, q.Delete())
+	})
+
+	t.Run("Invalid query", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(deftemplate person (slot name (type STRING)) (slot age (type INTEGER)))")
+		assert.NilError(t, err)
+		for _, fact := range []string{
+			`(person (name "alice") (age 40))`,
+			`(person (name "bob") (age 17))`,
+			`(person (name "carol") (age 65))`,
+			`(unrelated 1 2 3)`,
+		} {
+			_, err = env.AssertString(fact)
+			assert.NilError(t, err)
+		}
+
+		_, err = env.CompileFactQuery("person", "(> ?f:nosuch 1)")
+		assert.Assert(t, err != nil)
+	})
+}
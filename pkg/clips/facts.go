@@ -47,7 +47,8 @@ type Fact interface {
 	// String returns a string representation of the fact
 	String() string
 
-	// Drop drops the reference to the fact in CLIPS. should be called when done with the fact
+	// Drop drops the reference to the fact in CLIPS. This happens automatically when the fact is
+	// garbage collected, but may be called to release it sooner. It is safe to call more than once
 	Drop()
 
 	// Equal returns true if this fact equal the given fact
@@ -64,6 +65,12 @@ type Fact interface {
 
 	// Extract unmarshals the full fact into the user provided object
 	Extract(retval interface{}) error
+
+	// Dependencies returns the partial matches giving the fact logical support
+	Dependencies() ([]PartialMatch, error)
+
+	// Dependents returns the facts and instances that have logical support from the fact
+	Dependents() ([]interface{}, error)
 }
 
 // Facts returns a slice of all facts known to CLIPS
@@ -77,6 +84,19 @@ func (env *Environment) Facts() []Fact {
 	return ret
 }
 
+// FactByIndex returns the fact with the given index, e.g. 42 for f-42. CLIPS keeps no index of
+// facts by number, so this walks the fact list and takes time in proportion to the number of facts
+func (env *Environment) FactByIndex(index int) (Fact, error) {
+	factptr := C.EnvGetNextFact(env.env, nil)
+	for factptr != nil {
+		if int(C.EnvFactIndex(env.env, factptr)) == index {
+			return env.newFact(factptr), nil
+		}
+		factptr = C.EnvGetNextFact(env.env, factptr)
+	}
+	return nil, NotFoundError(fmt.Errorf("Fact f-%d not found", index))
+}
+
 // AssertString asserts a fact as a string.
 func (env *Environment) AssertString(factstr string) (Fact, error) {
 	cfactstr := C.CString(factstr)
@@ -152,6 +172,18 @@ func (env *Environment) newFact(fact unsafe.Pointer) Fact {
 	return createTemplateFact(env, fact)
 }
 
+// checkFact returns ErrStale unless factptr refers to a fact that is still usable: either
+// asserted, or created and not yet asserted
+func checkFact(env *Environment, factptr unsafe.Pointer) error {
+	if factptr == nil || env.env == nil {
+		return ErrStale
+	}
+	if C.EnvFactIndex(env.env, factptr) != 0 && C.EnvFactExistp(env.env, factptr) != 1 {
+		return ErrStale
+	}
+	return nil
+}
+
 func factPPString(env *Environment, factptr unsafe.Pointer) string {
 	// TODO grow buf if we fill the 1k buffer, and try again
 	var bufsize C.ulong = 1024
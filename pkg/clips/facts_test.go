@@ -16,7 +16,9 @@ package clips
 import (
 	"io/ioutil"
 	"os"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/udhos/equalfile"
 	"gotest.tools/assert"
@@ -151,4 +153,90 @@ func TestFacts(t *testing.T) {
 		_, err = env.FindTemplate("bif")
 		assert.ErrorContains(t, err, "not found")
 	})
+
+	t.Run("Fact by index", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		fact, err := env.AssertString(`(foo a b c)`)
+		assert.NilError(t, err)
+		_, err = env.AssertString(`(bar)`)
+		assert.NilError(t, err)
+
+		found, err := env.FactByIndex(fact.Index())
+		assert.NilError(t, err)
+		assert.Assert(t, found.Equal(fact))
+		assert.Equal(t, found.String(), "(foo a b c)")
+
+		_, err = env.FactByIndex(1000)
+		assert.ErrorContains(t, err, "f-1000 not found")
+		_, ok := err.(NotFoundError)
+		assert.Assert(t, ok)
+	})
+
+	t.Run("Stale fact", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(deftemplate foo (slot bar))")
+		assert.NilError(t, err)
+		fact, err := env.AssertString(`(foo (bar 1))`)
+		assert.NilError(t, err)
+		implied, err := env.AssertString(`(baz 1 2)`)
+		assert.NilError(t, err)
+
+		err = fact.Retract()
+		assert.NilError(t, err)
+		err = implied.Retract()
+		assert.NilError(t, err)
+		assert.Assert(t, !fact.Asserted())
+
+		_, err = fact.Slot("bar")
+		assert.Equal(t, err, ErrStale)
+		_, err = implied.Slots()
+		assert.Equal(t, err, ErrStale)
+		err = fact.Retract()
+		assert.Equal(t, err, ErrStale)
+
+		// dropping is idempotent, and the handle stays stale afterwards
+		fact.Drop()
+		fact.Drop()
+		var out map[string]interface{}
+		err = fact.Extract(&out)
+		assert.Equal(t, err, ErrStale)
+		assert.Equal(t, fact.Index(), 0)
+	})
+
+	t.Run("Fact outliving environment", func(t *testing.T) {
+		env := CreateEnvironment()
+		fact, err := env.AssertString(`(foo a b c)`)
+		assert.NilError(t, err)
+		env.Delete()
+
+		_, err = fact.Slots()
+		assert.Equal(t, err, ErrStale)
+		fact.Drop()
+	})
+
+	t.Run("Fact released when collected", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		fact, err := env.AssertString(`(foo a b c)`)
+		assert.NilError(t, err)
+		// a second handle keeps the fact in memory, so its count can be read
+		keep, err := env.FactByIndex(fact.Index())
+		assert.NilError(t, err)
+		factptr := keep.(*ImpliedFact).factptr
+		assert.NilError(t, fact.Retract())
+		count := factBusyCount(factptr)
+
+		fact = nil
+		for ii := 0; ii < 10 && factBusyCount(factptr) == count; ii++ {
+			runtime.GC()
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Equal(t, factBusyCount(factptr), count-1)
+		keep.Drop()
+	})
 }
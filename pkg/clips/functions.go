@@ -3,6 +3,48 @@ package clips
 // #cgo CFLAGS: -I ../../clips_source
 // #cgo LDFLAGS: -L ../../clips_source -l clips -lm
 // #include <clips/clips.h>
+//
+// int call_function(void *env, const char *name, struct dataObject *args, long argc, struct dataObject *result)
+// {
+//   struct expr theReference, *lastArg = NULL, *nextArg;
+//   long i;
+//   int error;
+//
+//   SetEvaluationError(env, FALSE);
+//   SetHaltExecution(env, FALSE);
+//   if (! GetFunctionReference(env, name, &theReference)) {
+//     /* a module-qualified name, e.g. MAIN::f, is only found by looking in that module */
+//     if ((theReference.value = EnvFindDeffunction(env, name)) != NULL) {
+//       theReference.type = PCALL;
+//     } else if ((theReference.value = EnvFindDefgeneric(env, name)) != NULL) {
+//       theReference.type = GCALL;
+//     } else {
+//       return TRUE;
+//     }
+//   }
+//   theReference.argList = NULL;
+//   theReference.nextArg = NULL;
+//   for (i = 0; i < argc; i++) {
+//     if (GetType(args[i]) == MULTIFIELD && GetDOLength(args[i]) > 0) {
+//       /* a multifield would become a chain of constants, so pass it as one create$ call */
+//       nextArg = GenConstant(env, FCALL, (void *) FindFunction(env, "create$"));
+//       nextArg->argList = ConvertValueToExpression(env, &args[i]);
+//     } else {
+//       nextArg = ConvertValueToExpression(env, &args[i]);
+//     }
+//     if (lastArg == NULL) {
+//       theReference.argList = nextArg;
+//     } else {
+//       lastArg->nextArg = nextArg;
+//     }
+//     lastArg = nextArg;
+//   }
+//   ExpressionInstall(env, &theReference);
+//   error = EvaluateExpression(env, &theReference, result);
+//   ExpressionDeinstall(env, &theReference);
+//   ReturnExpression(env, theReference.argList);
+//   return error;
+// }
 import "C"
 /*
    Copyright 2020 Keysight Technologies
@@ -51,6 +93,28 @@ func (env *Environment) FindFunction(name string) (*Function, error) {
 	return createFunction(env, fptr), nil
 }
 
+// generatedFunction returns the qualified name of a deffunction with the given parameters and body,
+// building it in MAIN the first time it is needed. The deffunction is kept for when the same body is
+// used again
+func (env *Environment) generatedFunction(prefix string, body string) (string, error) {
+	name, ok := env.generated[body]
+	if ok {
+		if _, err := env.FindFunction(name); err != nil {
+			// removed, e.g. by Clear
+			ok = false
+		}
+	}
+	if !ok {
+		env.queryCount++
+		name = fmt.Sprintf("MAIN::%s-%d", prefix, env.queryCount)
+		if err := env.Build(fmt.Sprintf("(deffunction %s %s)", name, body)); err != nil {
+			return "", err
+		}
+		env.generated[body] = name
+	}
+	return name, nil
+}
+
 func createFunction(env *Environment, fptr unsafe.Pointer) *Function {
 	return &Function{
 		env:  env,
@@ -92,6 +156,50 @@ func (f *Function) Call(arguments string) (interface{}, error) {
 	return data.Value(), nil
 }
 
+// CallValues calls the CLIPS function, passing each Go value as a separate argument
+func (f *Function) CallValues(args ...interface{}) (interface{}, error) {
+	return f.env.Call(f.Name(), args...)
+}
+
+// Call calls the named CLIPS function, which may be a deffunction, a generic,
+// or a built-in or user-defined function. Each Go value is converted to its
+// CLIPS equivalent and passed as a separate argument, so values need no
+// quoting and may include facts and instances
+func (env *Environment) Call(name string, args ...interface{}) (interface{}, error) {
+	data := createDataObject(env)
+	defer data.Delete()
+	ok, err := env.callFunction(data, name, args)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, EnvError(env, `Unable to call function "%s"`, name)
+	}
+	return data.Value(), nil
+}
+
+// callFunction evaluates the named function with the given arguments, returning false if evaluation failed
+// and an error if an argument could not be converted
+func (env *Environment) callFunction(retval *DataObject, name string, args []interface{}) (bool, error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	var cargs *C.struct_dataObject
+	if len(args) > 0 {
+		cargs = (*C.struct_dataObject)(C.malloc(C.size_t(len(args)) * C.sizeof_struct_dataObject))
+		defer C.free(unsafe.Pointer(cargs))
+		argv := (*[1 << 20]C.struct_dataObject)(unsafe.Pointer(cargs))[:len(args):len(args)]
+		for i, arg := range args {
+			if err := createDataObjectInitialized(env, &argv[i]).SetValue(arg); err != nil {
+				return false, fmt.Errorf(`Unable to convert argument %d of function "%s": %v`, i+1, name, err)
+			}
+		}
+	}
+
+	ret := C.call_function(env.env, cname, cargs, C.long(len(args)), retval.byRef())
+	return ret == 0, nil
+}
+
 // Module returns the module in which this function is defined
 func (f *Function) Module() *Module {
 	cmodname := C.EnvDeffunctionModule(f.env.env, f.fptr)
@@ -103,6 +103,64 @@ func TestFunctions(t *testing.T) {
 		assert.Equal(t, ret, int64(3))
 	})
 
+	t.Run("Function call values", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(deffunction foo (?a ?b) (str-cat ?a "/" ?b))`)
+		assert.NilError(t, err)
+
+		ftion, err := env.FindFunction("foo")
+		assert.NilError(t, err)
+
+		ret, err := ftion.CallValues(`a "quoted" string`, Symbol("sym"))
+		assert.NilError(t, err)
+		assert.Equal(t, ret, `a "quoted" string/sym`)
+
+		_, err = ftion.CallValues(1)
+		assert.ErrorContains(t, err, "Unable to call function")
+	})
+
+	t.Run("Env call", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		ret, err := env.Call("+", 1, 2.5)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, 3.5)
+
+		ret, err = env.Call("length$", []interface{}{Symbol("a"), "b", 3})
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(3))
+
+		ret, err = env.Call("nth$", 2, []interface{}{Symbol("a"), Symbol("b"), Symbol("c")})
+		assert.NilError(t, err)
+		assert.Equal(t, ret, Symbol("b"))
+
+		ret, err = env.Call("member$", Symbol("c"), []interface{}{Symbol("a"), Symbol("c")})
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(2))
+
+		ret, err = env.Call("length$", []interface{}{})
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(0))
+
+		fact, err := env.AssertString(`(foo a b c)`)
+		assert.NilError(t, err)
+		ret, err = env.Call("fact-index", fact)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(fact.Index()))
+
+		err = env.Build(`(deffunction bar (?a) (* ?a 2))`)
+		assert.NilError(t, err)
+		ret, err = env.Call("bar", 21)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(42))
+
+		_, err = env.Call("no-such-function")
+		assert.ErrorContains(t, err, "Unable to call function")
+	})
+
 	t.Run("Module", func(t *testing.T) {
 		env := CreateEnvironment()
 		defer env.Delete()
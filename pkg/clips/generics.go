@@ -101,6 +101,11 @@ func (g *Generic) Call(arguments string) (interface{}, error) {
 	return data.Value(), nil
 }
 
+// CallValues calls the CLIPS generic function, passing each Go value as a separate argument
+func (g *Generic) CallValues(args ...interface{}) (interface{}, error) {
+	return g.env.Call(g.Name(), args...)
+}
+
 // Module returns a reference to the module of this generic
 func (g *Generic) Module() *Module {
 	cmodname := C.EnvDefgenericModule(g.env.env, g.genptr)
@@ -111,6 +111,32 @@ func TestGeneric(t *testing.T) {
 		assert.ErrorContains(t, err, "No applicable methods")
 	})
 
+	t.Run("Generics call values", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(defgeneric foo "lame generic")`)
+		assert.NilError(t, err)
+		err = env.Build(`(defmethod foo ((?a INTEGER) (?b INTEGER)) (+ ?a ?b))`)
+		assert.NilError(t, err)
+		err = env.Build(`(defmethod foo ((?a STRING) (?b STRING)) (str-cat ?a ?b))`)
+		assert.NilError(t, err)
+
+		generic, err := env.FindGeneric("foo")
+		assert.NilError(t, err)
+
+		ret, err := generic.CallValues(1, 2)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(3))
+
+		ret, err = generic.CallValues("a b", " c")
+		assert.NilError(t, err)
+		assert.Equal(t, ret, "a b c")
+
+		_, err = generic.CallValues(1)
+		assert.ErrorContains(t, err, "No applicable methods")
+	})
+
 	t.Run("Module", func(t *testing.T) {
 		env := CreateEnvironment()
 		defer env.Delete()
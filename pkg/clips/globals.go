@@ -111,7 +111,9 @@ func (g *Global) SetValue(value interface{}) error {
 
 	data := createDataObject(g.env)
 	defer data.Delete()
-	data.SetValue(value)
+	if err := data.SetValue(value); err != nil {
+		return fmt.Errorf(`Unable to set value for global "%s": %v`, name, err)
+	}
 
 	ret := C.EnvSetDefglobalValue(g.env.env, cname, data.byRef())
 	if ret != 1 {
@@ -43,38 +43,42 @@ func createImpliedFact(env *Environment, factptr unsafe.Pointer) *ImpliedFact {
 		factptr: factptr,
 	}
 	C.EnvIncrementFactCount(env.env, factptr)
-	runtime.SetFinalizer(ret, func(*ImpliedFact) {
-		ret.Drop()
+	// the finalizer must not refer to ret, or ret would never become unreachable
+	runtime.SetFinalizer(ret, func(f *ImpliedFact) {
+		f.Drop()
 	})
 	return ret
 }
 
-// Drop drops the reference to the fact in CLIPS. should be called when done with the fact
+// Drop drops the reference to the fact in CLIPS. This happens automatically when the fact is
+// garbage collected, but may be called to release it sooner. It is safe to call more than once
 func (f *ImpliedFact) Drop() {
 	if f.factptr != nil {
-		C.EnvDecrementFactCount(f.env.env, f.factptr)
+		if f.env.env != nil {
+			C.EnvDecrementFactCount(f.env.env, f.factptr)
+		}
 		f.factptr = nil
 	}
 }
 
 // Index returns the index number of this fact within CLIPS
 func (f *ImpliedFact) Index() int {
+	if f.factptr == nil || f.env.env == nil {
+		return 0
+	}
 	return int(C.EnvFactIndex(f.env.env, f.factptr))
 }
 
 // Asserted returns true if the fact has been asserted.
 func (f *ImpliedFact) Asserted() bool {
-	if f.Index() == 0 {
-		return false
-	}
-	if C.EnvFactExistp(f.env.env, f.factptr) != 1 {
-		return false
-	}
-	return true
+	return checkFact(f.env, f.factptr) == nil && f.Index() != 0
 }
 
 // Assert asserts the fact
 func (f *ImpliedFact) Assert() error {
+	if err := checkFact(f.env, f.factptr); err != nil {
+		return err
+	}
 	if f.Asserted() {
 		return fmt.Errorf("Fact already asserted")
 	}
@@ -83,7 +87,9 @@ func (f *ImpliedFact) Assert() error {
 	if f.multifield == nil {
 		f.multifield = make([]interface{}, 0)
 	}
-	data.SetValue(f.multifield)
+	if err := data.SetValue(f.multifield); err != nil {
+		return fmt.Errorf("Unable to set slot for fact: %v", err)
+	}
 	ret := C.EnvPutFactSlot(f.env.env, f.factptr, nil, data.byRef())
 	if ret != 1 {
 		return EnvError(f.env, "Unable to set slot for fact")
@@ -102,6 +108,9 @@ func (f *ImpliedFact) Assert() error {
 
 // Retract retracts the fact from CLIPS
 func (f *ImpliedFact) Retract() error {
+	if err := checkFact(f.env, f.factptr); err != nil {
+		return err
+	}
 	ret := C.EnvRetract(f.env.env, f.factptr)
 	if ret != 1 {
 		return EnvError(f.env, "Unable to retract fact")
@@ -111,12 +120,18 @@ func (f *ImpliedFact) Retract() error {
 
 // Template returns the template defining this fact
 func (f *ImpliedFact) Template() *Template {
+	if f.factptr == nil || f.env.env == nil {
+		return nil
+	}
 	tplptr := C.EnvFactDeftemplate(f.env.env, f.factptr)
 	return createTemplate(f.env, tplptr)
 }
 
 // String returns a string representation of the fact
 func (f *ImpliedFact) String() string {
+	if f.factptr == nil || f.env.env == nil {
+		return ""
+	}
 	ret := factPPString(f.env, f.factptr)
 	split := strings.SplitN(ret, "     ", 2)
 	return strings.TrimRight(split[len(split)-1], "\n")
@@ -133,6 +148,9 @@ func (f *ImpliedFact) Equal(otherfact Fact) bool {
 
 // Slots returns a function that can be called to get the next slot for this fact. Will return nil when no more slots remain
 func (f *ImpliedFact) Slots() (map[string]interface{}, error) {
+	if err := checkFact(f.env, f.factptr); err != nil {
+		return nil, err
+	}
 	data, err := slotValue(f.env, f.factptr, "")
 	if err != nil {
 		return nil, err
@@ -145,6 +163,9 @@ func (f *ImpliedFact) Slots() (map[string]interface{}, error) {
 
 // Slot returns the value of the given slot. For Implied Facts, the only valid slot name is ""
 func (f *ImpliedFact) Slot(slotname string) (interface{}, error) {
+	if err := checkFact(f.env, f.factptr); err != nil {
+		return nil, err
+	}
 	if slotname != "" {
 		return nil, fmt.Errorf(`Invalid slot name "%s"`, slotname)
 	}
@@ -158,6 +179,9 @@ func (f *ImpliedFact) Slot(slotname string) (interface{}, error) {
 
 // ExtractSlot unmarshals the value of the given slot into the user provided object. For Implied Facts, the only valid slot name is ""
 func (f *ImpliedFact) ExtractSlot(retval interface{}, slotname string) error {
+	if err := checkFact(f.env, f.factptr); err != nil {
+		return err
+	}
 	if slotname != "" {
 		return fmt.Errorf(`Invalid slot name "%s"`, slotname)
 	}
@@ -29,6 +29,7 @@ import (
 type Instance struct {
 	env     *Environment
 	instptr unsafe.Pointer
+	binding *instanceBinding
 }
 
 // InstancesChanged returns true if any instance has changed
@@ -155,27 +156,46 @@ func createInstance(env *Environment, instptr unsafe.Pointer) *Instance {
 		instptr: instptr,
 	}
 	C.EnvIncrementInstanceCount(env.env, instptr)
-	runtime.SetFinalizer(ret, func(*Instance) {
-		ret.Drop()
+	// the finalizer must not refer to ret, or ret would never become unreachable
+	runtime.SetFinalizer(ret, func(inst *Instance) {
+		inst.Drop()
 	})
 	return ret
 
 }
 
-// Drop drops the reference to the instance in CLIPS. should be called when done with the instance
+// Drop drops the reference to the instance in CLIPS. This happens automatically when the instance
+// is garbage collected, but may be called to release it sooner. It is safe to call more than once.
+// A bound instance is held by the environment, so it is only released once dropped or unbound
 func (inst *Instance) Drop() {
+	if inst.binding != nil {
+		inst.Unbind()
+	}
 	if inst.instptr != nil {
-		C.EnvDecrementInstanceCount(inst.env.env, inst.instptr)
+		if inst.env.env != nil {
+			C.EnvDecrementInstanceCount(inst.env.env, inst.instptr)
+		}
 		inst.instptr = nil
 	}
 }
 
+// checkInstance returns ErrStale unless instptr refers to an instance that still exists
+func checkInstance(env *Environment, instptr unsafe.Pointer) error {
+	if instptr == nil || env.env == nil || C.EnvValidInstanceAddress(env.env, instptr) != 1 {
+		return ErrStale
+	}
+	return nil
+}
+
 // Equal returns true if the other instance represents the same CLIPS inst as this one
 func (inst *Instance) Equal(other *Instance) bool {
 	return inst.instptr == other.instptr
 }
 
 func (inst *Instance) String() string {
+	if checkInstance(inst.env, inst.instptr) != nil {
+		return ""
+	}
 	var bufsize C.ulong = 1024
 	buf := (*C.char)(C.malloc(C.sizeof_char * bufsize))
 	defer C.free(unsafe.Pointer(buf))
@@ -185,18 +205,27 @@ func (inst *Instance) String() string {
 
 // Name returns the name of this instance
 func (inst *Instance) Name() InstanceName {
+	if inst.instptr == nil || inst.env.env == nil {
+		return ""
+	}
 	ret := C.EnvGetInstanceName(inst.env.env, inst.instptr)
 	return InstanceName(C.GoString(ret))
 }
 
 // Class returns a reference to the class of this instance
 func (inst *Instance) Class() *Class {
+	if checkInstance(inst.env, inst.instptr) != nil {
+		return nil
+	}
 	clptr := C.EnvGetInstanceClass(inst.env.env, inst.instptr)
 	return createClass(inst.env, clptr)
 }
 
-// Slots returns a map of values for each slot by name
+// Slots returns a map of values for each slot by name, or nil if the instance no longer exists
 func (inst *Instance) Slots(inherited bool) map[string]interface{} {
+	if checkInstance(inst.env, inst.instptr) != nil {
+		return nil
+	}
 	cl := inst.Class()
 	slots := cl.Slots(inherited)
 	ret := make(map[string]interface{}, len(slots))
@@ -209,6 +238,9 @@ func (inst *Instance) Slots(inherited bool) map[string]interface{} {
 
 // Slot returns the value of the given slot. Warning, this function bypasses message-passing
 func (inst *Instance) Slot(name string) (interface{}, error) {
+	if err := checkInstance(inst.env, inst.instptr); err != nil {
+		return nil, err
+	}
 	cl := inst.Class()
 	_, err := cl.Slot(name)
 	if err != nil {
@@ -226,8 +258,13 @@ func (inst *Instance) slotValue(name string) interface{} {
 	return data.Value()
 }
 
-// SetSlot sets the slot to the given value. Warning, this function bypasses message-passing
+// SetSlot sets the slot to the given value. Warning, this function bypasses message-passing. In
+// MAP_ENTRIES mode the slot owns the MAP-ENTRY instances made for a map, and deletes those it held
+// before
 func (inst *Instance) SetSlot(name string, value interface{}) error {
+	if err := checkInstance(inst.env, inst.instptr); err != nil {
+		return err
+	}
 	typ := reflect.TypeOf(value)
 	if typ.Kind() == reflect.Ptr {
 		typ = typ.Elem()
@@ -240,12 +277,39 @@ func (inst *Instance) SetSlot(name string, value interface{}) error {
 		}
 		value = subinst.Name()
 	}
+	if inst.env.mapMode != MAP_ENTRIES {
+		return inst.putSlot(name, value)
+	}
+	old, err := inst.Slot(name)
+	if err != nil {
+		return err
+	}
+	made := inst.env.collectEntries()
+	err = inst.putSlot(name, value)
+	entries := made()
+	for _, entry := range entries {
+		if err != nil {
+			entry.Delete()
+		}
+		entry.Drop()
+	}
+	if err != nil {
+		return err
+	}
+	inst.env.deleteEntries(old)
+	return nil
+}
+
+// putSlot converts value and stores it in the slot
+func (inst *Instance) putSlot(name string, value interface{}) error {
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 	data := createDataObject(inst.env)
 	defer data.Delete()
 
-	data.SetValue(value)
+	if err := data.SetValue(value); err != nil {
+		return fmt.Errorf(`Unable to set slot "%s": %v`, name, err)
+	}
 
 	ret := C.EnvDirectPutSlot(inst.env.env, inst.instptr, cname, data.byRef())
 	if ret == 0 {
@@ -254,11 +318,33 @@ func (inst *Instance) SetSlot(name string, value interface{}) error {
 	return nil
 }
 
-// Send sends a message tot his instance. Message arguments must be provided as a string
-func (inst *Instance) Send(message string, arguments string) interface{} {
+// Send sends a message to this instance. Message arguments must be provided as a string
+func (inst *Instance) Send(message string, arguments string) (interface{}, error) {
+	if err := checkInstance(inst.env, inst.instptr); err != nil {
+		return nil, err
+	}
+	data := createDataObject(inst.env)
+	defer data.Delete()
+	if err := inst.send(data, message, arguments); err != nil {
+		return nil, err
+	}
+	return data.Value(), nil
+}
+
+// ExtractSend sends a message to this instance, storing its return value into the object passed by the user
+func (inst *Instance) ExtractSend(retval interface{}, message string, arguments string) error {
+	if err := checkInstance(inst.env, inst.instptr); err != nil {
+		return err
+	}
 	data := createDataObject(inst.env)
 	defer data.Delete()
+	if err := inst.send(data, message, arguments); err != nil {
+		return err
+	}
+	return data.ExtractValue(retval, false)
+}
 
+func (inst *Instance) send(data *DataObject, message string, arguments string) error {
 	instaddr := createDataObject(inst.env)
 	defer instaddr.Delete()
 	instaddr.SetValue(inst)
@@ -271,12 +357,41 @@ func (inst *Instance) Send(message string, arguments string) interface{} {
 		cargs = C.CString(arguments)
 		defer C.free(unsafe.Pointer(cargs))
 	}
+	C.SetEvaluationError(inst.env.env, 0)
 	C.EnvSend(inst.env.env, instaddr.byRef(), cmsg, cargs, data.byRef())
-	return data.Value()
+	if C.GetEvaluationError(inst.env.env) != 0 {
+		C.SetEvaluationError(inst.env.env, 0)
+		return EnvError(inst.env, `Unable to send message "%s"`, message)
+	}
+	return nil
+}
+
+// SendValues sends a message to this instance, passing each Go value as a separate argument
+func (inst *Instance) SendValues(message string, args ...interface{}) (interface{}, error) {
+	if err := checkInstance(inst.env, inst.instptr); err != nil {
+		return nil, err
+	}
+	sendargs := make([]interface{}, 0, len(args)+2)
+	sendargs = append(sendargs, inst, Symbol(message))
+	sendargs = append(sendargs, args...)
+
+	data := createDataObject(inst.env)
+	defer data.Delete()
+	ok, err := inst.env.callFunction(data, "send", sendargs)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, EnvError(inst.env, `Unable to send message "%s"`, message)
+	}
+	return data.Value(), nil
 }
 
 // Delete unmakes the instance within CLIPS, bypassing message passing
 func (inst *Instance) Delete() error {
+	if err := checkInstance(inst.env, inst.instptr); err != nil {
+		return err
+	}
 	ret := C.EnvDeleteInstance(inst.env.env, inst.instptr)
 	if ret != 1 {
 		return EnvError(inst.env, "Unable to delete instance")
@@ -286,6 +401,9 @@ func (inst *Instance) Delete() error {
 
 // Unmake unmakes the instance within CLIPS, using message passing
 func (inst *Instance) Unmake() error {
+	if err := checkInstance(inst.env, inst.instptr); err != nil {
+		return err
+	}
 	ret := C.EnvUnmakeInstance(inst.env.env, inst.instptr)
 	if ret != 1 {
 		return EnvError(inst.env, "Unable to unmake instance")
@@ -295,6 +413,9 @@ func (inst *Instance) Unmake() error {
 
 // ExtractSlot obtains the given slot value into the user-provided object
 func (inst *Instance) ExtractSlot(retval interface{}, name string) error {
+	if err := checkInstance(inst.env, inst.instptr); err != nil {
+		return err
+	}
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 	data := createDataObject(inst.env)
@@ -305,10 +426,21 @@ func (inst *Instance) ExtractSlot(retval interface{}, name string) error {
 
 // Extract attempts to marshall the CLIPS instance data into the user-provided or pointer
 // The return value can be a struct or a map of string to another datatype. If retval points
-// to a valid object, that object will be populated. If it is not, one will be created
+// to a valid object, that object will be populated. If it is not, one will be created. If retval
+// points to an interface and a Go type is registered for the instance's class by RegisterType, a
+// struct of that type is created
 func (inst *Instance) Extract(retval interface{}) error {
-	slots := inst.Slots(true)
+	if err := checkInstance(inst.env, inst.instptr); err != nil {
+		return err
+	}
 	knownInstances := make(map[InstanceName]interface{})
+	ptr := reflect.ValueOf(retval)
+	if ptr.Kind() == reflect.Ptr && !ptr.IsNil() && ptr.Elem().Kind() == reflect.Interface {
+		if typ, ok := inst.env.registeredType(inst.Class(), ptr.Elem().Type()); ok {
+			return inst.env.extractRegistered(ptr.Elem(), inst, typ, knownInstances)
+		}
+	}
+	slots := inst.Slots(true)
 	knownInstances[inst.Name()] = retval
 	return inst.env.structuredExtract(retval, slots, true, knownInstances)
 }
@@ -0,0 +1,225 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// InstanceSetMember is one member of an instance-set: a variable, and the classes whose
+// instances it ranges over
+type InstanceSetMember struct {
+	Var     string
+	Classes []string
+}
+
+// InstanceQuery describes an instance-set query, as used by find-all-instances and related functions
+type InstanceQuery struct {
+	// Members are the members of the instance-set
+	Members []InstanceSetMember
+
+	// Query is a CLIPS expression the instance-set must satisfy, which may refer to member
+	// variables and parameters, e.g. (eq ?p:employer ?c). If it is "", all instance-sets match
+	Query string
+
+	// Params gives Go values for variables used in the query, by name
+	Params map[string]interface{}
+}
+
+// FindInstances returns every instance-set satisfying the query, as a tuple with one instance
+// per member of the instance-set, in order
+func (env *Environment) FindInstances(spec InstanceQuery) ([][]*Instance, error) {
+	ret, err := env.runInstanceQuery("find-all-instances", spec)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := ret.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Unexpected result from query: %v", ret)
+	}
+	width := len(spec.Members)
+	tuples := make([][]*Instance, 0, len(list)/width)
+	for ii := 0; ii+width <= len(list); ii += width {
+		tuple, err := env.instanceTuple(list[ii : ii+width])
+		if err != nil {
+			return nil, err
+		}
+		tuples = append(tuples, tuple)
+	}
+	return tuples, nil
+}
+
+// FindFirstInstances returns the first instance-set satisfying the query, or nil if there is none
+func (env *Environment) FindFirstInstances(spec InstanceQuery) ([]*Instance, error) {
+	ret, err := env.runInstanceQuery("find-instance", spec)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := ret.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Unexpected result from query: %v", ret)
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return env.instanceTuple(list)
+}
+
+// AnyInstances returns true if any instance-set satisfies the query
+func (env *Environment) AnyInstances(spec InstanceQuery) (bool, error) {
+	ret, err := env.runInstanceQuery("any-instancep", spec)
+	if err != nil {
+		return false, err
+	}
+	found, ok := ret.(bool)
+	if !ok {
+		return false, fmt.Errorf("Unexpected result from query: %v", ret)
+	}
+	return found, nil
+}
+
+// ExtractInstances runs the query, unmarshaling the instance-sets found into retval, which must
+// be a pointer to a slice. For a single member instance-set, the elements may be anything an
+// instance can be extracted to. Otherwise the elements must be structs with a field per
+// member, named by the member variable in the same way as slots, e.g.
+//
+//	type Row struct {
+//		Person  Person  `clips:"p"`
+//		Company Company `clips:"c"`
+//	}
+//
+// Elements of type []*Instance receive the tuples as they are
+func (env *Environment) ExtractInstances(retval interface{}, spec InstanceQuery) error {
+	ptr := reflect.ValueOf(retval)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() || ptr.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("Unable to store instances to %T, expected a pointer to a slice", retval)
+	}
+	tuples, err := env.FindInstances(spec)
+	if err != nil {
+		return err
+	}
+	slice := ptr.Elem()
+	slice.Set(reflect.MakeSlice(slice.Type(), 0, len(tuples)))
+	elemType := slice.Type().Elem()
+	fields, rows := memberFields(elemType, spec.Members)
+	for _, tuple := range tuples {
+		elem := reflect.New(elemType)
+		switch {
+		case reflect.TypeOf(tuple).AssignableTo(elemType):
+			elem.Elem().Set(reflect.ValueOf(tuple))
+		case rows:
+			row := elem.Elem()
+			for ii, inst := range tuple {
+				if _, ok := fields[ii]; !ok {
+					continue
+				}
+				if err := inst.Extract(row.FieldByIndex(fields[ii]).Addr().Interface()); err != nil {
+					return err
+				}
+			}
+		case len(tuple) == 1:
+			if err := tuple[0].Extract(elem.Interface()); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf(`Type "%v" has no fields for the instance-set members`, elemType)
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+	return nil
+}
+
+// memberFields finds the fields of typ that hold each member of an instance-set, by member index
+func memberFields(typ reflect.Type, members []InstanceSetMember) (map[int][]int, bool) {
+	ret := make(map[int][]int)
+	if typ.Kind() != reflect.Struct {
+		return ret, false
+	}
+	for ii := 0; ii < typ.NumField(); ii++ {
+		field := typ.Field(ii)
+		name := slotTagFor(field).name
+		for jj, member := range members {
+			if name == strings.TrimPrefix(member.Var, "?") {
+				ret[jj] = field.Index
+			}
+		}
+	}
+	return ret, len(ret) > 0
+}
+
+func (env *Environment) instanceTuple(names []interface{}) ([]*Instance, error) {
+	ret := make([]*Instance, len(names))
+	for ii, v := range names {
+		switch name := v.(type) {
+		case InstanceName:
+			inst, err := env.FindInstance(name, "")
+			if err != nil {
+				return nil, err
+			}
+			ret[ii] = inst
+		case *Instance:
+			ret[ii] = name
+		default:
+			return nil, fmt.Errorf("Unexpected result from query: %v", v)
+		}
+	}
+	return ret, nil
+}
+
+// runInstanceQuery calls the given query function through a deffunction taking the parameters.
+// The deffunction is kept for when the same query is run again
+func (env *Environment) runInstanceQuery(function string, spec InstanceQuery) (interface{}, error) {
+	if len(spec.Members) == 0 {
+		return nil, fmt.Errorf("Instance-set query must have at least one member")
+	}
+	var set strings.Builder
+	set.WriteString("(")
+	for _, member := range spec.Members {
+		if member.Var == "" || len(member.Classes) == 0 {
+			return nil, fmt.Errorf("Instance-set member must have a variable and at least one class")
+		}
+		fmt.Fprintf(&set, "(?%s %s)", strings.TrimPrefix(member.Var, "?"), strings.Join(member.Classes, " "))
+	}
+	set.WriteString(")")
+	query := spec.Query
+	if query == "" {
+		query = "TRUE"
+	}
+	params := make([]string, 0, len(spec.Params))
+	for name := range spec.Params {
+		params = append(params, strings.TrimPrefix(name, "?"))
+	}
+	sort.Strings(params)
+	args := make([]interface{}, len(params))
+	vars := make([]string, len(params))
+	for ii, name := range params {
+		if v, ok := spec.Params[name]; ok {
+			args[ii] = v
+		} else {
+			args[ii] = spec.Params["?"+name]
+		}
+		vars[ii] = "?" + name
+	}
+
+	body := fmt.Sprintf("(%s) (%s %s %s)", strings.Join(vars, " "), function, set.String(), query)
+	name, err := env.generatedFunction("clipsgo-instance-query", body)
+	if err != nil {
+		return nil, err
+	}
+	return env.Call(name, args...)
+}
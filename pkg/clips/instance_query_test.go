@@ -0,0 +1,248 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+type QueryCompany struct {
+	Title string
+	Size  int
+}
+
+type QueryEmployee struct {
+	Name     string
+	Employer InstanceName
+}
+
+var employerQuery = InstanceQuery{
+	Members: []InstanceSetMember{
+		{Var: "e", Classes: []string{"QueryEmployee"}},
+		{Var: "c", Classes: []string{"QueryCompany"}},
+	},
+	Query: "(and (eq ?e:Employer (instance-name ?c)) (>= ?c:Size ?min))",
+	Params: map[string]interface{}{
+		"min": 100,
+	},
+}
+
+func TestFindInstances(t *testing.T) {
+	t.Run("Join", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := env.InsertClass((*QueryCompany)(nil))
+		assert.NilError(t, err)
+		_, err = env.InsertClass((*QueryEmployee)(nil))
+		assert.NilError(t, err)
+		for _, cmd := range []string{
+			`(acme of QueryCompany (Title "Acme") (Size 500))`,
+			`(tiny of QueryCompany (Title "Tiny") (Size 5))`,
+			`(alice of QueryEmployee (Name "alice") (Employer [acme]))`,
+			`(bob of QueryEmployee (Name "bob") (Employer [tiny]))`,
+			`(carol of QueryEmployee (Name "carol") (Employer [acme]))`,
+		} {
+			_, err = env.MakeInstance(cmd)
+			assert.NilError(t, err)
+		}
+
+		tuples, err := env.FindInstances(employerQuery)
+		assert.NilError(t, err)
+		assert.Equal(t, len(tuples), 2)
+		assert.Equal(t, tuples[0][0].Name(), InstanceName("alice"))
+		assert.Equal(t, tuples[0][1].Name(), InstanceName("acme"))
+		assert.Equal(t, tuples[1][0].Name(), InstanceName("carol"))
+
+		// same query, different parameters
+		spec := employerQuery
+		spec.Params = map[string]interface{}{"min": 1}
+		tuples, err = env.FindInstances(spec)
+		assert.NilError(t, err)
+		assert.Equal(t, len(tuples), 3)
+	})
+
+	t.Run("Other current module", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := env.InsertClass((*QueryCompany)(nil))
+		assert.NilError(t, err)
+		_, err = env.InsertClass((*QueryEmployee)(nil))
+		assert.NilError(t, err)
+		for _, cmd := range []string{
+			`(acme of QueryCompany (Title "Acme") (Size 500))`,
+			`(tiny of QueryCompany (Title "Tiny") (Size 5))`,
+			`(alice of QueryEmployee (Name "alice") (Employer [acme]))`,
+			`(bob of QueryEmployee (Name "bob") (Employer [tiny]))`,
+			`(carol of QueryEmployee (Name "carol") (Employer [acme]))`,
+		} {
+			_, err = env.MakeInstance(cmd)
+			assert.NilError(t, err)
+		}
+
+		err = env.Build("(defmodule OTHER)")
+		assert.NilError(t, err)
+		other, err := env.FindModule("OTHER")
+		assert.NilError(t, err)
+		env.SetFocus(other)
+		assert.Equal(t, env.CurrentModule().Name(), "OTHER")
+
+		tuples, err := env.FindInstances(employerQuery)
+		assert.NilError(t, err)
+		assert.Equal(t, len(tuples), 2)
+
+		// run again from the cached deffunction
+		found, err := env.AnyInstances(employerQuery)
+		assert.NilError(t, err)
+		assert.Assert(t, found)
+		tuples, err = env.FindInstances(employerQuery)
+		assert.NilError(t, err)
+		assert.Equal(t, len(tuples), 2)
+	})
+
+	t.Run("First and any", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := env.InsertClass((*QueryCompany)(nil))
+		assert.NilError(t, err)
+		_, err = env.InsertClass((*QueryEmployee)(nil))
+		assert.NilError(t, err)
+		for _, cmd := range []string{
+			`(acme of QueryCompany (Title "Acme") (Size 500))`,
+			`(tiny of QueryCompany (Title "Tiny") (Size 5))`,
+			`(alice of QueryEmployee (Name "alice") (Employer [acme]))`,
+			`(bob of QueryEmployee (Name "bob") (Employer [tiny]))`,
+			`(carol of QueryEmployee (Name "carol") (Employer [acme]))`,
+		} {
+			_, err = env.MakeInstance(cmd)
+			assert.NilError(t, err)
+		}
+
+		tuple, err := env.FindFirstInstances(employerQuery)
+		assert.NilError(t, err)
+		assert.Equal(t, len(tuple), 2)
+		assert.Equal(t, tuple[0].Name(), InstanceName("alice"))
+
+		found, err := env.AnyInstances(employerQuery)
+		assert.NilError(t, err)
+		assert.Assert(t, found)
+
+		spec := employerQuery
+		spec.Params = map[string]interface{}{"min": 1000}
+		tuple, err = env.FindFirstInstances(spec)
+		assert.NilError(t, err)
+		assert.Assert(t, tuple == nil)
+		found, err = env.AnyInstances(spec)
+		assert.NilError(t, err)
+		assert.Assert(t, !found)
+	})
+
+	t.Run("Extract rows", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := env.InsertClass((*QueryCompany)(nil))
+		assert.NilError(t, err)
+		_, err = env.InsertClass((*QueryEmployee)(nil))
+		assert.NilError(t, err)
+		for _, cmd := range []string{
+			`(acme of QueryCompany (Title "Acme") (Size 500))`,
+			`(tiny of QueryCompany (Title "Tiny") (Size 5))`,
+			`(alice of QueryEmployee (Name "alice") (Employer [acme]))`,
+			`(bob of QueryEmployee (Name "bob") (Employer [tiny]))`,
+			`(carol of QueryEmployee (Name "carol") (Employer [acme]))`,
+		} {
+			_, err = env.MakeInstance(cmd)
+			assert.NilError(t, err)
+		}
+
+		type Row struct {
+			Employee QueryEmployee `clips:"e"`
+			Company  *QueryCompany `clips:"c"`
+		}
+		var rows []Row
+		err = env.ExtractInstances(&rows, employerQuery)
+		assert.NilError(t, err)
+		assert.Equal(t, len(rows), 2)
+		assert.Equal(t, rows[1].Employee.Name, "carol")
+		assert.Equal(t, rows[1].Company.Title, "Acme")
+
+		var tuples [][]*Instance
+		err = env.ExtractInstances(&tuples, employerQuery)
+		assert.NilError(t, err)
+		assert.Equal(t, len(tuples), 2)
+	})
+
+	t.Run("Extract single member", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := env.InsertClass((*QueryCompany)(nil))
+		assert.NilError(t, err)
+		_, err = env.InsertClass((*QueryEmployee)(nil))
+		assert.NilError(t, err)
+		for _, cmd := range []string{
+			`(acme of QueryCompany (Title "Acme") (Size 500))`,
+			`(tiny of QueryCompany (Title "Tiny") (Size 5))`,
+			`(alice of QueryEmployee (Name "alice") (Employer [acme]))`,
+			`(bob of QueryEmployee (Name "bob") (Employer [tiny]))`,
+			`(carol of QueryEmployee (Name "carol") (Employer [acme]))`,
+		} {
+			_, err = env.MakeInstance(cmd)
+			assert.NilError(t, err)
+		}
+
+		var companies []QueryCompany
+		err = env.ExtractInstances(&companies, InstanceQuery{
+			Members: []InstanceSetMember{{Var: "?c", Classes: []string{"QueryCompany"}}},
+			Query:   `(str-index ?prefix ?c:Title)`,
+			Params:  map[string]interface{}{"prefix": "Ti"},
+		})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, companies, []QueryCompany{{Title: "Tiny", Size: 5}})
+	})
+
+	t.Run("Invalid spec", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := env.InsertClass((*QueryCompany)(nil))
+		assert.NilError(t, err)
+		_, err = env.InsertClass((*QueryEmployee)(nil))
+		assert.NilError(t, err)
+		for _, cmd := range []string{
+			`(acme of QueryCompany (Title "Acme") (Size 500))`,
+			`(tiny of QueryCompany (Title "Tiny") (Size 5))`,
+			`(alice of QueryEmployee (Name "alice") (Employer [acme]))`,
+			`(bob of QueryEmployee (Name "bob") (Employer [tiny]))`,
+			`(carol of QueryEmployee (Name "carol") (Employer [acme]))`,
+		} {
+			_, err = env.MakeInstance(cmd)
+			assert.NilError(t, err)
+		}
+
+		_, err = env.FindInstances(InstanceQuery{})
+		assert.ErrorContains(t, err, "at least one member")
+
+		_, err = env.FindInstances(InstanceQuery{
+			Members: []InstanceSetMember{{Var: "x", Classes: []string{"NoSuchClass"}}},
+		})
+		assert.Assert(t, err != nil)
+	})
+}
@@ -403,18 +403,74 @@ func TestInstance(t *testing.T) {
 		inst, err := env.MakeInstance(`(of Foo (bar 12))`)
 		assert.NilError(t, err)
 
-		ret := inst.Send("get-bar", "")
+		ret, err := inst.Send("get-bar", "")
+		assert.NilError(t, err)
 		assert.Equal(t, ret, int64(12))
 
-		ret = inst.Send("put-bar", "77")
+		ret, err = inst.Send("put-bar", "77")
+		assert.NilError(t, err)
 		assert.Equal(t, ret, int64(77))
 
 		ret, err = inst.Slot("bar")
 		assert.NilError(t, err)
 		assert.Equal(t, ret, int64(77))
 
-		ret = inst.Send("garbage", "")
-		assert.Equal(t, ret, false)
+		_, err = inst.Send("garbage", "")
+		assert.ErrorContains(t, err, `Unable to send message "garbage"`)
+
+		// the error should not leak into later sends
+		ret, err = inst.Send("get-bar", "")
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(77))
+	})
+
+	t.Run("Extract send", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(defclass Foo (is-a USER) (slot bar (type INTEGER)) (multislot baz))`)
+		assert.NilError(t, err)
+
+		inst, err := env.MakeInstance(`(of Foo (bar 12) (baz a b c))`)
+		assert.NilError(t, err)
+
+		var intval int
+		err = inst.ExtractSend(&intval, "get-bar", "")
+		assert.NilError(t, err)
+		assert.Equal(t, intval, 12)
+
+		var strslice []string
+		err = inst.ExtractSend(&strslice, "get-baz", "")
+		assert.NilError(t, err)
+		assert.DeepEqual(t, strslice, []string{"a", "b", "c"})
+
+		err = inst.ExtractSend(&intval, "garbage", "")
+		assert.ErrorContains(t, err, `Unable to send message "garbage"`)
+	})
+
+	t.Run("Send values", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(defclass Foo (is-a USER) (slot bar (type INTEGER)) (multislot baz))`)
+		assert.NilError(t, err)
+
+		inst, err := env.MakeInstance(`(of Foo (bar 12))`)
+		assert.NilError(t, err)
+
+		ret, err := inst.SendValues("get-bar")
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(12))
+
+		_, err = inst.SendValues("put-baz", "a b", Symbol("c"), 4)
+		assert.NilError(t, err)
+
+		ret, err = inst.Slot("baz")
+		assert.NilError(t, err)
+		assert.DeepEqual(t, ret, []interface{}{"a b", Symbol("c"), int64(4)})
+
+		_, err = inst.SendValues("garbage")
+		assert.ErrorContains(t, err, `Unable to send message "garbage"`)
 	})
 
 	t.Run("Delete", func(t *testing.T) {
@@ -1026,3 +1082,46 @@ func TestExtract(t *testing.T) {
 		assert.Equal(t, ret, true)
 	})
 }
+
+func TestStaleInstance(t *testing.T) {
+	t.Run("Deleted", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(defclass Foo (is-a USER) (slot bar))")
+		assert.NilError(t, err)
+		inst, err := env.MakeInstance("(foo of Foo (bar 1))")
+		assert.NilError(t, err)
+
+		err = inst.Delete()
+		assert.NilError(t, err)
+
+		_, err = inst.Slot("bar")
+		assert.Equal(t, err, ErrStale)
+		err = inst.SetSlot("bar", 2)
+		assert.Equal(t, err, ErrStale)
+		_, err = inst.Send("print", "")
+		assert.Equal(t, err, ErrStale)
+		err = inst.Delete()
+		assert.Equal(t, err, ErrStale)
+		assert.Assert(t, inst.Slots(true) == nil)
+
+		inst.Drop()
+		inst.Drop()
+		assert.Equal(t, inst.Name(), InstanceName(""))
+	})
+
+	t.Run("Outliving environment", func(t *testing.T) {
+		env := CreateEnvironment()
+		err := env.Build("(defclass Foo (is-a USER) (slot bar))")
+		assert.NilError(t, err)
+		inst, err := env.MakeInstance("(foo of Foo (bar 1))")
+		assert.NilError(t, err)
+		env.Delete()
+
+		var out map[string]interface{}
+		err = inst.Extract(&out)
+		assert.Equal(t, err, ErrStale)
+		inst.Drop()
+	})
+}
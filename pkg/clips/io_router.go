@@ -0,0 +1,357 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+)
+
+// InputRouter is implemented by routers that supply input to CLIPS. A plain
+// Router's Getc has no way to signal the end of input; if a router implements
+// InputRouter, ReadChar is called instead of Getc
+type InputRouter interface {
+	Router
+
+	// ReadChar is called by CLIPS to obtain a character from input. It should return io.EOF at the end of input
+	ReadChar(name string) (byte, error)
+}
+
+// WriterRouter is a router that sends CLIPS output to an io.Writer
+type WriterRouter struct {
+	core   *RouterCore
+	writer io.Writer
+}
+
+// ReaderRouter is a router that supplies CLIPS input from an io.Reader
+type ReaderRouter struct {
+	core   *RouterCore
+	reader *bufio.Reader
+	input  inputBuffer
+}
+
+// LineInputRouter is a router that supplies CLIPS input one line at a time from a Go function
+type LineInputRouter struct {
+	core   *RouterCore
+	next   func(name string) (string, error)
+	inputs map[string]*lineInput
+}
+
+type lineInput struct {
+	inputBuffer
+	line []byte
+}
+
+// inputBuffer implements the Getc / Ungetc protocol CLIPS expects on top of a source of characters
+type inputBuffer struct {
+	pushback   []byte
+	lastEOF    bool
+	pendingEOF bool
+}
+
+var defaultWriterNames = []string{
+	"stdout",
+	"wdisplay",
+}
+
+var defaultReaderNames = []string{
+	"stdin",
+}
+
+var ioRouterCount int32
+
+func ioRouterName(kind string) string {
+	return fmt.Sprintf("go-%s-router-%d", kind, atomic.AddInt32(&ioRouterCount, 1))
+}
+
+// NewWriterRouter returns a router that writes CLIPS output for the given
+// logical names to w. If no names are given, stdout and wdisplay are used
+func NewWriterRouter(env *Environment, w io.Writer, names ...string) *WriterRouter {
+	if len(names) == 0 {
+		names = defaultWriterNames
+	}
+	return newWriterRouter(env, w, ioRouterName("writer"), names, 30)
+}
+
+func newWriterRouter(env *Environment, w io.Writer, name string, names []string, priority int) *WriterRouter {
+	ret := &WriterRouter{
+		writer: w,
+	}
+	ret.core = CreateRouterCore(env, ret, name, names, priority)
+	return ret
+}
+
+// Capture calls fn, collecting everything CLIPS prints to the given logical
+// names while it runs, and returns the collected output along with the error
+// returned by fn. If no names are given, all of the standard output names are
+// captured. The capture takes precedence over other Go routers, but error
+// messages are still seen by the environment's error handling. Captures may be
+// nested; output goes to the innermost one
+func (env *Environment) Capture(fn func() error, names ...string) (string, error) {
+	if len(names) == 0 {
+		names = loggingHandlers
+	}
+	var buf strings.Builder
+	// below the ErrorRouter, so that it still collects error messages before passing them on
+	capture := newWriterRouter(env, &buf, ioRouterName("capture"), names, 35)
+	defer capture.Delete()
+
+	err := fn()
+	return buf.String(), err
+}
+
+// Name of this router
+func (r *WriterRouter) Name() string {
+	return r.core.Name()
+}
+
+// Query should return true if the router handles the given logical IO name
+func (r *WriterRouter) Query(name string) bool {
+	return r.core.Query(name)
+}
+
+// Print is called with a message if Query has returned true
+func (r *WriterRouter) Print(name string, message string) {
+	io.WriteString(r.writer, message)
+}
+
+// Getc is called by CLIPS to obtain a character from input
+func (r *WriterRouter) Getc(name string) byte {
+	return 0
+}
+
+// Ungetc is called by CLIPS to push a character back into the input queue
+func (r *WriterRouter) Ungetc(name string, ch byte) error {
+	return fmt.Errorf("Not implemented")
+}
+
+// Exit is called by CLIPS before CLIPS itself exits
+func (r *WriterRouter) Exit(exitcode int) {
+}
+
+// Activate activates this router with the Env
+func (r *WriterRouter) Activate() error {
+	return r.core.Activate()
+}
+
+// Deactivate deactivates this router with the Env
+func (r *WriterRouter) Deactivate() error {
+	return r.core.Deactivate()
+}
+
+// Delete removes this router from the Env
+func (r *WriterRouter) Delete() error {
+	return r.core.Delete()
+}
+
+// NewReaderRouter returns a router that supplies CLIPS input for the given
+// logical names from r, for use by read, readline and similar functions. If no
+// names are given, stdin is used
+func NewReaderRouter(env *Environment, r io.Reader, names ...string) *ReaderRouter {
+	if len(names) == 0 {
+		names = defaultReaderNames
+	}
+	ret := &ReaderRouter{
+		reader: bufio.NewReader(r),
+	}
+	ret.core = CreateRouterCore(env, ret, ioRouterName("reader"), names, 30)
+	return ret
+}
+
+// Name of this router
+func (r *ReaderRouter) Name() string {
+	return r.core.Name()
+}
+
+// Query should return true if the router handles the given logical IO name
+func (r *ReaderRouter) Query(name string) bool {
+	return r.core.Query(name)
+}
+
+// Print is called with a message if Query has returned true. Output to an input router is discarded
+func (r *ReaderRouter) Print(name string, message string) {
+}
+
+// ReadChar returns the next character of input, or io.EOF at the end of input
+func (r *ReaderRouter) ReadChar(name string) (byte, error) {
+	return r.input.readChar(r.reader.ReadByte)
+}
+
+// Getc is called by CLIPS to obtain a character from input
+func (r *ReaderRouter) Getc(name string) byte {
+	ch, _ := r.ReadChar(name)
+	return ch
+}
+
+// Ungetc is called by CLIPS to push a character back into the input queue
+func (r *ReaderRouter) Ungetc(name string, ch byte) error {
+	r.input.unreadChar(ch)
+	return nil
+}
+
+// Exit is called by CLIPS before CLIPS itself exits
+func (r *ReaderRouter) Exit(exitcode int) {
+}
+
+// Activate activates this router with the Env
+func (r *ReaderRouter) Activate() error {
+	return r.core.Activate()
+}
+
+// Deactivate deactivates this router with the Env
+func (r *ReaderRouter) Deactivate() error {
+	return r.core.Deactivate()
+}
+
+// Delete removes this router from the Env
+func (r *ReaderRouter) Delete() error {
+	return r.core.Delete()
+}
+
+// NewLineInputRouter returns a router that supplies CLIPS input for the given
+// logical names from a Go function. Whenever CLIPS needs more input, next is
+// called with the logical name being read and should return the next line of
+// input, blocking if necessary. A newline is added to the line if it does not
+// end in one. next should return io.EOF at the end of input. If no names are
+// given, stdin is used
+func NewLineInputRouter(env *Environment, next func(name string) (string, error), names ...string) *LineInputRouter {
+	if len(names) == 0 {
+		names = defaultReaderNames
+	}
+	ret := &LineInputRouter{
+		next:   next,
+		inputs: make(map[string]*lineInput),
+	}
+	ret.core = CreateRouterCore(env, ret, ioRouterName("line-input"), names, 30)
+	return ret
+}
+
+// NewChannelInputRouter returns a router that supplies CLIPS input for the
+// given logical names from a channel of lines. Reading blocks until a line is
+// available; closing the channel ends the input. If no names are given, stdin
+// is used
+func NewChannelInputRouter(env *Environment, lines <-chan string, names ...string) *LineInputRouter {
+	return NewLineInputRouter(env, func(name string) (string, error) {
+		line, ok := <-lines
+		if !ok {
+			return "", io.EOF
+		}
+		return line, nil
+	}, names...)
+}
+
+// Name of this router
+func (r *LineInputRouter) Name() string {
+	return r.core.Name()
+}
+
+// Query should return true if the router handles the given logical IO name
+func (r *LineInputRouter) Query(name string) bool {
+	return r.core.Query(name)
+}
+
+// Print is called with a message if Query has returned true. Output to an input router is discarded
+func (r *LineInputRouter) Print(name string, message string) {
+}
+
+func (r *LineInputRouter) inputFor(name string) *lineInput {
+	in, ok := r.inputs[name]
+	if !ok {
+		in = &lineInput{}
+		r.inputs[name] = in
+	}
+	return in
+}
+
+// ReadChar returns the next character of input, or io.EOF at the end of input
+func (r *LineInputRouter) ReadChar(name string) (byte, error) {
+	in := r.inputFor(name)
+	return in.readChar(func() (byte, error) {
+		for len(in.line) == 0 {
+			line, err := r.next(name)
+			if err != nil {
+				return 0, err
+			}
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n"
+			}
+			in.line = []byte(line)
+		}
+		ch := in.line[0]
+		in.line = in.line[1:]
+		return ch, nil
+	})
+}
+
+// Getc is called by CLIPS to obtain a character from input
+func (r *LineInputRouter) Getc(name string) byte {
+	ch, _ := r.ReadChar(name)
+	return ch
+}
+
+// Ungetc is called by CLIPS to push a character back into the input queue
+func (r *LineInputRouter) Ungetc(name string, ch byte) error {
+	r.inputFor(name).unreadChar(ch)
+	return nil
+}
+
+// Exit is called by CLIPS before CLIPS itself exits
+func (r *LineInputRouter) Exit(exitcode int) {
+}
+
+// Activate activates this router with the Env
+func (r *LineInputRouter) Activate() error {
+	return r.core.Activate()
+}
+
+// Deactivate deactivates this router with the Env
+func (r *LineInputRouter) Deactivate() error {
+	return r.core.Deactivate()
+}
+
+// Delete removes this router from the Env
+func (r *LineInputRouter) Delete() error {
+	return r.core.Delete()
+}
+
+func (b *inputBuffer) readChar(next func() (byte, error)) (byte, error) {
+	if b.pendingEOF {
+		b.pendingEOF = false
+		b.lastEOF = true
+		return 0, io.EOF
+	}
+	if n := len(b.pushback); n > 0 {
+		ch := b.pushback[n-1]
+		b.pushback = b.pushback[:n-1]
+		b.lastEOF = false
+		return ch, nil
+	}
+	ch, err := next()
+	b.lastEOF = err != nil
+	return ch, err
+}
+
+func (b *inputBuffer) unreadChar(ch byte) {
+	if b.lastEOF {
+		// CLIPS pushes back the EOF it just read; make sure it sees it again
+		b.lastEOF = false
+		b.pendingEOF = true
+		return
+	}
+	b.pushback = append(b.pushback, ch)
+}
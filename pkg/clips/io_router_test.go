@@ -0,0 +1,309 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestWriterRouter(t *testing.T) {
+	t.Run("Create WriterRouter", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		var buf bytes.Buffer
+		wr := NewWriterRouter(env, &buf)
+
+		_, err := env.Eval(`(printout t "Testing" crlf)`)
+		assert.NilError(t, err)
+		_, err = env.Eval(`(printout t "1 2 3")`)
+		assert.NilError(t, err)
+		// no line buffering, output appears as it is printed
+		assert.Equal(t, buf.String(), "Testing\n1 2 3")
+
+		err = wr.Delete()
+		assert.NilError(t, err)
+
+		buf.Reset()
+		_, err = env.Eval(`(printout t "Testing" crlf)`)
+		assert.NilError(t, err)
+		assert.Equal(t, buf.String(), "")
+	})
+
+	t.Run("Named logical names", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		var buf bytes.Buffer
+		wr := NewWriterRouter(env, &buf, "mylog")
+		defer wr.Delete()
+		assert.Assert(t, wr.Query("mylog"))
+		assert.Assert(t, !wr.Query("stdout"))
+
+		_, err := env.Eval(`(printout mylog "to the log" crlf)`)
+		assert.NilError(t, err)
+		assert.Equal(t, buf.String(), "to the log\n")
+	})
+
+	t.Run("Unique names", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		var buf bytes.Buffer
+		wr1 := NewWriterRouter(env, &buf)
+		defer wr1.Delete()
+		wr2 := NewWriterRouter(env, &buf, "mylog")
+		defer wr2.Delete()
+		assert.Assert(t, wr1.Name() != wr2.Name())
+	})
+}
+
+func TestCapture(t *testing.T) {
+	t.Run("Capture output", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		out, err := env.Capture(func() error {
+			return env.SendCommand(`(printout t "captured" crlf)`)
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, out, "captured\n")
+
+		// the capture router is removed afterwards
+		var buf bytes.Buffer
+		wr := NewWriterRouter(env, &buf)
+		defer wr.Delete()
+		_, err = env.Eval(`(printout t "not captured" crlf)`)
+		assert.NilError(t, err)
+		assert.Equal(t, buf.String(), "not captured\n")
+	})
+
+	t.Run("Capture precedence", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		var buf bytes.Buffer
+		wr := NewWriterRouter(env, &buf)
+		defer wr.Delete()
+
+		out, err := env.Capture(func() error {
+			_, err := env.Eval(`(printout t "captured" crlf)`)
+			return err
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, out, "captured\n")
+		assert.Equal(t, buf.String(), "")
+	})
+
+	t.Run("Capture names", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		var buf bytes.Buffer
+		wr := NewWriterRouter(env, &buf)
+		defer wr.Delete()
+
+		out, err := env.Capture(func() error {
+			_, err := env.Eval(`(printout t "stdout" crlf)`)
+			if err != nil {
+				return err
+			}
+			_, err = env.Eval(`(printout mylog "mylog" crlf)`)
+			return err
+		}, "mylog")
+		assert.NilError(t, err)
+		assert.Equal(t, out, "mylog\n")
+		assert.Equal(t, buf.String(), "stdout\n")
+	})
+
+	t.Run("Nested capture", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		var inner string
+		outer, err := env.Capture(func() error {
+			if _, err := env.Eval(`(printout t "outer" crlf)`); err != nil {
+				return err
+			}
+			var err error
+			inner, err = env.Capture(func() error {
+				_, err := env.Eval(`(printout t "inner" crlf)`)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			_, err = env.Eval(`(printout t "outer again" crlf)`)
+			return err
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, inner, "inner\n")
+		assert.Equal(t, outer, "outer\nouter again\n")
+	})
+
+	t.Run("Capture errors", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		out, err := env.Capture(func() error {
+			_, err := env.Eval("(create$ 1 2 3")
+			return err
+		})
+		assert.Equal(t, err.Error(), "Unable to parse construct \"(create$ 1 2 3\": [EXPRNPSR2] Expected a constant, variable, or expression.")
+		assert.Assert(t, strings.Contains(out, "[EXPRNPSR2]"))
+	})
+}
+
+func TestReaderRouter(t *testing.T) {
+	t.Run("Read", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		rr := NewReaderRouter(env, strings.NewReader("foo 12\n\"a string\"\n"))
+		defer rr.Delete()
+
+		ret, err := env.Eval(`(read)`)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, Symbol("foo"))
+
+		ret, err = env.Eval(`(read)`)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(12))
+
+		ret, err = env.Eval(`(read)`)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, "a string")
+
+		ret, err = env.Eval(`(read)`)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, Symbol("EOF"))
+	})
+
+	t.Run("Readline", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		rr := NewReaderRouter(env, strings.NewReader("first line\nsecond line"), "input")
+		defer rr.Delete()
+
+		ret, err := env.Eval(`(readline input)`)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, "first line")
+
+		ret, err = env.Eval(`(readline input)`)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, "second line")
+
+		ret, err = env.Eval(`(readline input)`)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, Symbol("EOF"))
+	})
+
+	t.Run("Ungetc", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		rr := NewReaderRouter(env, strings.NewReader("ab"))
+		defer rr.Delete()
+
+		assert.Equal(t, rr.Getc("stdin"), byte('a'))
+		assert.NilError(t, rr.Ungetc("stdin", 'a'))
+		assert.Equal(t, rr.Getc("stdin"), byte('a'))
+		assert.Equal(t, rr.Getc("stdin"), byte('b'))
+
+		_, err := rr.ReadChar("stdin")
+		assert.ErrorContains(t, err, "EOF")
+		// pushing back the EOF means it is read again
+		assert.NilError(t, rr.Ungetc("stdin", 0xff))
+		_, err = rr.ReadChar("stdin")
+		assert.ErrorContains(t, err, "EOF")
+	})
+}
+
+func TestLineInputRouter(t *testing.T) {
+	t.Run("Input function", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		answers := []string{"yes", "42\n"}
+		asked := make([]string, 0)
+		lr := NewLineInputRouter(env, func(name string) (string, error) {
+			asked = append(asked, name)
+			if len(answers) == 0 {
+				return "", io.EOF
+			}
+			ret := answers[0]
+			answers = answers[1:]
+			return ret, nil
+		})
+		defer lr.Delete()
+
+		ret, err := env.Eval(`(readline)`)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, "yes")
+
+		ret, err = env.Eval(`(read)`)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(42))
+
+		ret, err = env.Eval(`(readline)`)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, Symbol("EOF"))
+		assert.Equal(t, asked[0], "stdin")
+	})
+
+	t.Run("Channel input", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(defrule ask
+			=>
+			(printout t "Name? ")
+			(assert (name (readline answers))))`)
+		assert.NilError(t, err)
+
+		var buf bytes.Buffer
+		wr := NewWriterRouter(env, &buf)
+		defer wr.Delete()
+
+		lines := make(chan string)
+		lr := NewChannelInputRouter(env, lines, "answers")
+		defer lr.Delete()
+
+		done := make(chan int64)
+		go func() {
+			done <- env.Run(-1)
+		}()
+		lines <- "Bob Smith"
+		assert.Equal(t, <-done, int64(1))
+		assert.Equal(t, buf.String(), "Name? ")
+
+		facts := env.Facts()
+		var slots []interface{}
+		err = facts[len(facts)-1].Extract(&slots)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, slots, []interface{}{"Bob Smith"})
+
+		close(lines)
+		ret, err := env.Eval(`(read answers)`)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, Symbol("EOF"))
+	})
+}
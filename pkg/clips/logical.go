@@ -0,0 +1,173 @@
+package clips
+
+// #cgo CFLAGS: -I ../../clips_source
+// #cgo LDFLAGS: -L ../../clips_source -l clips -lm
+// #include <clips/clips.h>
+//
+// void *first_dependency(void *entity)
+// {
+//   return ((struct patternEntity *) entity)->dependents;
+// }
+//
+// void *next_dependency(void *dep)
+// {
+//   return ((struct dependency *) dep)->next;
+// }
+//
+// int match_size(void *dep)
+// {
+//   return ((struct partialMatch *) ((struct dependency *) dep)->dPtr)->bcount;
+// }
+//
+// void *match_item(void *dep, int i, int *type)
+// {
+//   struct partialMatch *pm = (struct partialMatch *) ((struct dependency *) dep)->dPtr;
+//   struct alphaMatch *am = pm->binds[i].gm.theMatch;
+//
+//   if ((am == NULL) || (am->matchingItem == NULL)) {
+//     return NULL;
+//   }
+//   *type = am->matchingItem->theInfo->base.type;
+//   return am->matchingItem;
+// }
+//
+// int supported_by(void *entity, void *item)
+// {
+//   struct dependency *dep;
+//   struct partialMatch *pm;
+//   unsigned short i;
+//
+//   for (dep = ((struct patternEntity *) entity)->dependents; dep != NULL; dep = dep->next) {
+//     pm = (struct partialMatch *) dep->dPtr;
+//     for (i = 0; i < pm->bcount; i++) {
+//       if ((pm->binds[i].gm.theMatch != NULL) && (pm->binds[i].gm.theMatch->matchingItem == item)) {
+//         return TRUE;
+//       }
+//     }
+//   }
+//   return FALSE;
+// }
+import "C"
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"unsafe"
+)
+
+// PartialMatch is the list of facts and instances matching the patterns of a rule, in order. An
+// element is a Fact, an *Instance, or nil for a pattern with nothing to match, such as a not CE
+type PartialMatch []interface{}
+
+// Dependencies returns the partial matches giving this fact logical support, one for each
+// activation whose logical conditional elements asserted it. A fact asserted outside of a logical
+// CE has none, and is not retracted when the matches go away
+func (f *TemplateFact) Dependencies() ([]PartialMatch, error) {
+	if err := checkFact(f.env, f.factptr); err != nil {
+		return nil, err
+	}
+	return f.env.dependencies(f.factptr)
+}
+
+// Dependents returns the facts and instances that have logical support from this fact, and so
+// would be retracted or deleted along with it. Each element is a Fact or an *Instance
+func (f *TemplateFact) Dependents() ([]interface{}, error) {
+	if err := checkFact(f.env, f.factptr); err != nil {
+		return nil, err
+	}
+	return f.env.dependents(f.factptr)
+}
+
+// Dependencies returns the partial matches giving this fact logical support, one for each
+// activation whose logical conditional elements asserted it. A fact asserted outside of a logical
+// CE has none, and is not retracted when the matches go away
+func (f *ImpliedFact) Dependencies() ([]PartialMatch, error) {
+	if err := checkFact(f.env, f.factptr); err != nil {
+		return nil, err
+	}
+	return f.env.dependencies(f.factptr)
+}
+
+// Dependents returns the facts and instances that have logical support from this fact, and so
+// would be retracted or deleted along with it. Each element is a Fact or an *Instance
+func (f *ImpliedFact) Dependents() ([]interface{}, error) {
+	if err := checkFact(f.env, f.factptr); err != nil {
+		return nil, err
+	}
+	return f.env.dependents(f.factptr)
+}
+
+// Dependencies returns the partial matches giving this instance logical support, one for each
+// activation whose logical conditional elements made it
+func (inst *Instance) Dependencies() ([]PartialMatch, error) {
+	if err := checkInstance(inst.env, inst.instptr); err != nil {
+		return nil, err
+	}
+	return inst.env.dependencies(inst.instptr)
+}
+
+// Dependents returns the facts and instances that have logical support from this instance, and so
+// would be retracted or deleted along with it. Each element is a Fact or an *Instance
+func (inst *Instance) Dependents() ([]interface{}, error) {
+	if err := checkInstance(inst.env, inst.instptr); err != nil {
+		return nil, err
+	}
+	return inst.env.dependents(inst.instptr)
+}
+
+// dependencies walks the partial matches the fact or instance depends on, as the CLIPS
+// dependencies command does
+func (env *Environment) dependencies(entity unsafe.Pointer) ([]PartialMatch, error) {
+	ret := make([]PartialMatch, 0)
+	for dep := C.first_dependency(entity); dep != nil; dep = C.next_dependency(dep) {
+		match := make(PartialMatch, int(C.match_size(dep)))
+		for ii := range match {
+			var typ C.int
+			if item := C.match_item(dep, C.int(ii), &typ); item != nil {
+				match[ii] = env.patternEntity(item, typ)
+			}
+		}
+		ret = append(ret, match)
+	}
+	return ret, nil
+}
+
+// dependents finds the facts and instances with a partial match including the given fact or
+// instance among their dependencies, as the CLIPS dependents command does
+func (env *Environment) dependents(entity unsafe.Pointer) ([]interface{}, error) {
+	ret := make([]interface{}, 0)
+	for factptr := C.EnvGetNextFact(env.env, nil); factptr != nil; factptr = C.EnvGetNextFact(env.env, factptr) {
+		if C.supported_by(factptr, entity) == 1 {
+			ret = append(ret, env.newFact(factptr))
+		}
+	}
+	for instptr := C.EnvGetNextInstance(env.env, nil); instptr != nil; instptr = C.EnvGetNextInstance(env.env, instptr) {
+		if C.supported_by(instptr, entity) == 1 {
+			ret = append(ret, createInstance(env, instptr))
+		}
+	}
+	return ret, nil
+}
+
+// patternEntity returns the Fact or *Instance a pattern matched
+func (env *Environment) patternEntity(item unsafe.Pointer, typ C.int) interface{} {
+	switch typ {
+	case C.FACT_ADDRESS:
+		return env.newFact(item)
+	case C.INSTANCE_ADDRESS:
+		return createInstance(env, item)
+	}
+	return nil
+}
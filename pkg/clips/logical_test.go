@@ -0,0 +1,142 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestLogicalSupport(t *testing.T) {
+	t.Run("Fact", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		for _, construct := range []string{
+			"(defclass Derived (is-a USER) (slot value))",
+			"(defrule derive-fact (logical (source ?x) (weight ?w)) => (assert (derived ?x ?w)))",
+			"(defrule derive-instance (logical (source ?x)) => (make-instance of Derived (value ?x)))",
+		} {
+			err := env.Build(construct)
+			assert.NilError(t, err)
+		}
+
+		source, err := env.AssertString("(source 1)")
+		assert.NilError(t, err)
+		weight, err := env.AssertString("(weight 5)")
+		assert.NilError(t, err)
+		env.Run(-1)
+
+		dependents, err := source.Dependents()
+		assert.NilError(t, err)
+		assert.Equal(t, len(dependents), 2)
+
+		var derived Fact
+		for _, dep := range dependents {
+			if fact, ok := dep.(Fact); ok {
+				derived = fact
+			}
+		}
+		assert.Assert(t, derived != nil)
+		assert.Equal(t, derived.String(), "(derived 1 5)")
+
+		matches, err := derived.Dependencies()
+		assert.NilError(t, err)
+		assert.Equal(t, len(matches), 1)
+		assert.Equal(t, len(matches[0]), 2)
+		assert.Assert(t, matches[0][0].(Fact).Equal(source))
+		assert.Assert(t, matches[0][1].(Fact).Equal(weight))
+
+		// no logical support
+		matches, err = source.Dependencies()
+		assert.NilError(t, err)
+		assert.Equal(t, len(matches), 0)
+
+		// retracting the support retracts the derived fact
+		err = weight.Retract()
+		assert.NilError(t, err)
+		assert.Assert(t, !derived.Asserted())
+		_, err = derived.Dependencies()
+		assert.Equal(t, err, ErrStale)
+	})
+
+	t.Run("Instance", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		for _, construct := range []string{
+			"(defclass Derived (is-a USER) (slot value))",
+			"(defrule derive-fact (logical (source ?x) (weight ?w)) => (assert (derived ?x ?w)))",
+			"(defrule derive-instance (logical (source ?x)) => (make-instance of Derived (value ?x)))",
+		} {
+			err := env.Build(construct)
+			assert.NilError(t, err)
+		}
+
+		source, err := env.AssertString("(source 2)")
+		assert.NilError(t, err)
+		env.Run(-1)
+
+		cls, err := env.FindClass("Derived")
+		assert.NilError(t, err)
+		instances := cls.Instances()
+		assert.Equal(t, len(instances), 1)
+
+		matches, err := instances[0].Dependencies()
+		assert.NilError(t, err)
+		assert.Equal(t, len(matches), 1)
+		assert.Assert(t, matches[0][0].(Fact).Equal(source))
+
+		dependents, err := instances[0].Dependents()
+		assert.NilError(t, err)
+		assert.Equal(t, len(dependents), 0)
+
+		dependents, err = source.Dependents()
+		assert.NilError(t, err)
+		assert.Equal(t, len(dependents), 1)
+		assert.Assert(t, dependents[0].(*Instance).Equal(instances[0]))
+	})
+
+	t.Run("Not CE", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		for _, construct := range []string{
+			"(defclass Derived (is-a USER) (slot value))",
+			"(defrule derive-fact (logical (source ?x) (weight ?w)) => (assert (derived ?x ?w)))",
+			"(defrule derive-instance (logical (source ?x)) => (make-instance of Derived (value ?x)))",
+		} {
+			err := env.Build(construct)
+			assert.NilError(t, err)
+		}
+
+		err := env.Build("(defrule derive-quiet (logical (source ?x) (not (alarm))) => (assert (quiet ?x)))")
+		assert.NilError(t, err)
+		source, err := env.AssertString("(source 3)")
+		assert.NilError(t, err)
+		env.Run(-1)
+
+		quiet, err := env.FactByIndex(source.Index() + 1)
+		assert.NilError(t, err)
+		assert.Equal(t, quiet.String(), "(quiet 3)")
+		matches, err := quiet.Dependencies()
+		assert.NilError(t, err)
+		assert.Equal(t, len(matches), 1)
+		assert.Equal(t, len(matches[0]), 2)
+		assert.Assert(t, matches[0][0].(Fact).Equal(source))
+		assert.Assert(t, matches[0][1] == nil)
+	})
+}
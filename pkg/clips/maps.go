@@ -0,0 +1,321 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MapMode determines how Go maps with string keys are represented in CLIPS
+type MapMode int
+
+const (
+	// MAP_MULTIFIELD represents a map as a multifield of alternating keys and values, e.g. (a 1 b 2)
+	MAP_MULTIFIELD MapMode = iota
+	// MAP_ENTRIES represents a map held in an instance slot as a multifield of the instance names
+	// of MAP-ENTRY instances, each with a key slot and a value multislot. Values may be nested maps
+	// or slices. The slot owns the entries, which are deleted when its value is replaced through
+	// Instance.SetSlot, as by Sync. Elsewhere, such as in fact slots and function arguments, maps
+	// are represented as by MAP_MULTIFIELD
+	MAP_ENTRIES
+)
+
+var clipsMapModes = [...]string{
+	"MAP_MULTIFIELD",
+	"MAP_ENTRIES",
+}
+
+func (mode MapMode) String() string {
+	if mode < 0 || int(mode) >= len(clipsMapModes) {
+		return fmt.Sprintf("MapMode(%d)", mode)
+	}
+	return clipsMapModes[int(mode)]
+}
+
+// MapEntryClass is the name of the class used for map entries in MAP_ENTRIES mode
+const MapEntryClass = "MAP-ENTRY"
+
+// SetMapMode sets how Go maps are represented in CLIPS. The default is MAP_MULTIFIELD
+func (env *Environment) SetMapMode(mode MapMode) {
+	env.mapMode = mode
+}
+
+// MapMode returns how Go maps are represented in CLIPS
+func (env *Environment) MapMode() MapMode {
+	return env.mapMode
+}
+
+type mapEntry struct {
+	key       string
+	value     interface{}
+	multislot bool
+}
+
+// entryClass returns the MAP-ENTRY class, defining it if need be
+func (env *Environment) entryClass() (*Class, error) {
+	cls, err := env.FindClass(MapEntryClass)
+	if err == nil {
+		return cls, nil
+	}
+	if _, ok := err.(NotFoundError); !ok {
+		return nil, err
+	}
+	if err := env.Build(fmt.Sprintf("(defclass %s (is-a USER) (slot key (type SYMBOL STRING)) (multislot value))", MapEntryClass)); err != nil {
+		return nil, err
+	}
+	return env.FindClass(MapEntryClass)
+}
+
+// mapKey returns the lexeme holding a map key: a symbol if the key reads back as the same symbol,
+// e.g. color, and otherwise a string, so keys such as nil, TRUE or "two words" round-trip
+func (env *Environment) mapKey(key string) interface{} {
+	switch {
+	case key == "", key == "nil", key == "TRUE", key == "FALSE", Symbol(key) == env.nilSymbol:
+		return key
+	case strings.HasPrefix(key, "?"), strings.HasPrefix(key, "$?"):
+		return key
+	case strings.IndexFunc(key, func(r rune) bool { return !unicode.IsPrint(r) || unicode.IsSpace(r) }) >= 0:
+		return key
+	case strings.ContainsAny(key, `"()&|<~;`):
+		return key
+	}
+	if _, err := strconv.ParseFloat(key, 64); err == nil {
+		return key
+	}
+	return Symbol(key)
+}
+
+// collectEntries starts collecting the MAP-ENTRY instances made while an instance slot is set,
+// returning a function that ends the collection and returns them. Maps only become entries while
+// collecting. Collections may nest, in which case the outermost one gets the entries
+func (env *Environment) collectEntries() func() []*Instance {
+	if env.newEntries != nil {
+		return func() []*Instance { return nil }
+	}
+	entries := make([]*Instance, 0)
+	env.newEntries = &entries
+	return func() []*Instance {
+		env.newEntries = nil
+		return entries
+	}
+}
+
+// deleteEntries deletes the MAP-ENTRY instances named in value, along with those nested in them
+func (env *Environment) deleteEntries(value interface{}) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return
+	}
+	for _, item := range list {
+		name, ok := item.(InstanceName)
+		if !ok {
+			continue
+		}
+		inst, err := env.FindInstance(name, "")
+		if err != nil {
+			continue
+		}
+		if inst.Class().Name() == MapEntryClass {
+			env.deleteEntries(inst.slotValue("value"))
+			inst.Delete()
+		}
+		inst.Drop()
+	}
+}
+
+// mapFacets returns the attributes of an instance multislot holding a map
+func (env *Environment) mapFacets(typ reflect.Type) (string, error) {
+	if typ.Key().Kind() != reflect.String {
+		return "", fmt.Errorf("Key type must be type string")
+	}
+	if env.mapMode != MAP_ENTRIES {
+		return "", nil
+	}
+	if _, err := env.entryClass(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(" (type INSTANCE-NAME) (allowed-classes %s)", MapEntryClass), nil
+}
+
+// mapValue converts a map to a multifield according to the map mode, making MAP-ENTRY instances
+// only while an instance slot is being set. Keys are sorted, so the result is the same each time
+func (env *Environment) mapValue(val reflect.Value) ([]interface{}, error) {
+	typ := val.Type()
+	if typ.Key().Kind() != reflect.String {
+		return nil, fmt.Errorf("Key type must be type string")
+	}
+	keys := make([]string, 0, val.Len())
+	for _, k := range val.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+
+	if env.mapMode == MAP_ENTRIES && env.newEntries != nil {
+		cls, err := env.entryClass()
+		if err != nil {
+			return nil, err
+		}
+		ret := make([]interface{}, 0, len(keys))
+		for _, k := range keys {
+			v, err := env.clipsCompatible(val.MapIndex(reflect.ValueOf(k).Convert(typ.Key())).Interface())
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := v.([]interface{}); !ok {
+				v = []interface{}{v}
+			}
+			inst, err := cls.NewInstance("", true)
+			if err != nil {
+				return nil, err
+			}
+			*env.newEntries = append(*env.newEntries, inst)
+			if err := inst.putSlot("key", env.mapKey(k)); err != nil {
+				return nil, err
+			}
+			if err := inst.putSlot("value", v); err != nil {
+				return nil, err
+			}
+			ret = append(ret, inst.Name())
+		}
+		return ret, nil
+	}
+
+	ret := make([]interface{}, 0, 2*len(keys))
+	for _, k := range keys {
+		v, err := env.clipsCompatible(val.MapIndex(reflect.ValueOf(k).Convert(typ.Key())).Interface())
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := v.([]interface{}); ok {
+			return nil, fmt.Errorf(`Unable to represent multifield value for key "%s"; nested values need MAP_ENTRIES mode and an instance slot`, k)
+		}
+		ret = append(ret, env.mapKey(k), v)
+	}
+	return ret, nil
+}
+
+// mapEntries returns the entries of list, if it is a list of MAP-ENTRY instances
+func (env *Environment) mapEntries(list []interface{}) ([]mapEntry, bool) {
+	if len(list) == 0 {
+		return nil, false
+	}
+	ret := make([]mapEntry, 0, len(list))
+	for _, item := range list {
+		var inst *Instance
+		switch v := item.(type) {
+		case InstanceName:
+			var err error
+			if inst, err = env.FindInstance(v, ""); err != nil {
+				return nil, false
+			}
+		case *Instance:
+			inst = v
+		default:
+			return nil, false
+		}
+		if inst.Class().Name() != MapEntryClass {
+			return nil, false
+		}
+		key, err := inst.Slot("key")
+		if err != nil {
+			return nil, false
+		}
+		keystr, err := lexemeFor(key)
+		if err != nil {
+			return nil, false
+		}
+		value, err := inst.Slot("value")
+		if err != nil {
+			return nil, false
+		}
+		ret = append(ret, mapEntry{
+			key:       keystr,
+			value:     value,
+			multislot: true,
+		})
+	}
+	return ret, true
+}
+
+// extractMap fills a map from a multifield holding either representation of a map
+func (env *Environment) extractMap(val reflect.Value, list []interface{}, extractClasses bool, knownInstances map[InstanceName]interface{}) error {
+	typ := val.Type()
+	if typ.Key().Kind() != reflect.String {
+		return fmt.Errorf("Key type must be type string")
+	}
+	entries, ok := env.mapEntries(list)
+	if !ok {
+		if len(list)%2 != 0 {
+			return fmt.Errorf("Unable to extract map from multifield of odd length %d", len(list))
+		}
+		entries = make([]mapEntry, 0, len(list)/2)
+		for ii := 0; ii < len(list); ii += 2 {
+			key, err := lexemeFor(list[ii])
+			if err != nil {
+				return fmt.Errorf("Unable to extract map key: %v", err)
+			}
+			entries = append(entries, mapEntry{
+				key:   key,
+				value: list[ii+1],
+			})
+		}
+	}
+	if val.IsNil() {
+		val.Set(reflect.MakeMapWithSize(typ, len(entries)))
+	}
+	for _, entry := range entries {
+		value := entry.value
+		if values, ok := value.([]interface{}); ok && entry.multislot {
+			var err error
+			if value, err = env.entryValue(typ.Elem(), values, extractClasses, knownInstances); err != nil {
+				return err
+			}
+		}
+		elem := reflect.New(typ.Elem()).Elem()
+		if err := env.convertArg(elem, reflect.ValueOf(value), extractClasses, knownInstances); err != nil {
+			return err
+		}
+		val.SetMapIndex(reflect.ValueOf(entry.key).Convert(typ.Key()), elem)
+	}
+	return nil
+}
+
+// entryValue picks the value of a MAP-ENTRY, which is always held as a multifield, to suit the target type
+func (env *Environment) entryValue(typ reflect.Type, values []interface{}, extractClasses bool, knownInstances map[InstanceName]interface{}) (interface{}, error) {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return values, nil
+	case reflect.Interface:
+		if _, ok := env.mapEntries(values); ok {
+			nested := reflect.New(reflect.TypeOf(map[string]interface{}{})).Elem()
+			if err := env.extractMap(nested, values, extractClasses, knownInstances); err != nil {
+				return nil, err
+			}
+			return nested.Interface(), nil
+		}
+	}
+	if len(values) == 1 {
+		return values[0], nil
+	}
+	return values, nil
+}
@@ -0,0 +1,226 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+type MapClass struct {
+	Name   string `json:"name"`
+	Labels map[string]string
+	Attrs  map[string]interface{}
+}
+
+func TestMapValues(t *testing.T) {
+	t.Run("Multifield conversion", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		ret, err := env.Call("create$", map[string]int{"b": 2, "a": 1})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, ret, []interface{}{Symbol("a"), int64(1), Symbol("b"), int64(2)})
+
+		var out map[string]int
+		err = env.ExtractEval(&out, "(create$ a 1 b 2)")
+		assert.NilError(t, err)
+		assert.DeepEqual(t, out, map[string]int{"a": 1, "b": 2})
+
+		err = env.ExtractEval(&out, "(create$ a 1 b)")
+		assert.ErrorContains(t, err, "odd length")
+
+		_, err = env.Call("create$", map[int]int{1: 2})
+		assert.ErrorContains(t, err, "Key type must be type string")
+
+		_, err = env.Call("create$", map[string]interface{}{"a": []int{1, 2}})
+		assert.ErrorContains(t, err, "MAP_ENTRIES")
+	})
+
+	t.Run("Keys that are not plain symbols", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		in := map[string]int{"a": 1, "nil": 2, "TRUE": 3, "two words": 4, "(x)": 5, "12": 6}
+		ret, err := env.Call("create$", in)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, ret, []interface{}{
+			"(x)", int64(5), "12", int64(6), "TRUE", int64(3), Symbol("a"), int64(1), "nil", int64(2), "two words", int64(4),
+		})
+
+		var out map[string]int
+		err = env.ExtractEval(&out, `(create$ "nil" 2 a 1)`)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, out, map[string]int{"a": 1, "nil": 2})
+	})
+
+	t.Run("Entries owned by instance slots", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		env.SetMapMode(MAP_ENTRIES)
+		cls, err := env.entryClass()
+		assert.NilError(t, err)
+
+		// outside an instance slot a map is a plain multifield
+		ret, err := env.Call("create$", map[string]int{"FALSE": 1})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, ret, []interface{}{"FALSE", int64(1)})
+		assert.Equal(t, len(cls.Instances()), 0)
+
+		err = env.Build("(deftemplate holder (multislot attrs))")
+		assert.NilError(t, err)
+		tpl, err := env.FindTemplate("holder")
+		assert.NilError(t, err)
+		err = tpl.Slots()["attrs"].Check(map[string]int{"x": 1})
+		assert.NilError(t, err)
+		assert.Equal(t, len(cls.Instances()), 0)
+
+		_, err = env.InsertClass((*MapClass)(nil))
+		assert.NilError(t, err)
+		inst, err := env.Insert("box", MapClass{
+			Attrs: map[string]interface{}{"owner": map[string]interface{}{"name": "alice"}},
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, len(cls.Instances()), 2)
+
+		key, err := env.Eval(`(do-for-instance ((?e MAP-ENTRY)) (eq ?e:key owner) ?e:key)`)
+		assert.NilError(t, err)
+		assert.Equal(t, key, Symbol("owner"))
+
+		// replacing the map deletes the entries the slot held, nested ones included
+		err = inst.SetSlot("Attrs", map[string]interface{}{"FALSE": 3})
+		assert.NilError(t, err)
+		assert.Equal(t, len(cls.Instances()), 1)
+		key, err = env.Eval(`(do-for-instance ((?e MAP-ENTRY)) TRUE ?e:key)`)
+		assert.NilError(t, err)
+		assert.Equal(t, key, "FALSE")
+
+		err = inst.SetSlot("Attrs", []interface{}{})
+		assert.NilError(t, err)
+		assert.Equal(t, len(cls.Instances()), 0)
+	})
+
+	t.Run("Multifield insert", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		cls, err := env.InsertClass((*MapClass)(nil))
+		assert.NilError(t, err)
+		assert.Equal(t, cls.String(), `(defclass MAIN::MapClass
+   (is-a USER)
+   (slot _name
+      (type STRING))
+   (multislot Labels)
+   (multislot Attrs))`)
+
+		data := MapClass{
+			Name:   "box",
+			Labels: map[string]string{"color": "red", "size": "large"},
+			Attrs:  map[string]interface{}{"weight": int64(3)},
+		}
+		inst, err := env.Insert("box", data)
+		assert.NilError(t, err)
+		assert.Equal(t, inst.String(), `[box] of MapClass (_name "box") (Labels color "red" size "large") (Attrs weight 3)`)
+
+		var out MapClass
+		err = inst.Extract(&out)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, out, data)
+	})
+
+	t.Run("Entries insert", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		env.SetMapMode(MAP_ENTRIES)
+		assert.Equal(t, env.MapMode(), MAP_ENTRIES)
+		assert.Equal(t, env.MapMode().String(), "MAP_ENTRIES")
+		assert.Equal(t, MapMode(2).String(), "MapMode(2)")
+		cls, err := env.InsertClass((*MapClass)(nil))
+		assert.NilError(t, err)
+		assert.Equal(t, cls.String(), `(defclass MAIN::MapClass
+   (is-a USER)
+   (slot _name
+      (type STRING))
+   (multislot Labels
+      (type INSTANCE-NAME)
+      (allowed-classes MAP-ENTRY))
+   (multislot Attrs
+      (type INSTANCE-NAME)
+      (allowed-classes MAP-ENTRY)))`)
+
+		data := MapClass{
+			Name:   "box",
+			Labels: map[string]string{"color": "red"},
+			Attrs: map[string]interface{}{
+				"sizes": []interface{}{int64(1), int64(2)},
+				"owner": map[string]interface{}{
+					"name": "alice",
+				},
+			},
+		}
+		inst, err := env.Insert("box", data)
+		assert.NilError(t, err)
+
+		ret, err := env.Eval(`(do-for-instance ((?e MAP-ENTRY)) (eq ?e:key color) ?e:value)`)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, ret, []interface{}{"red"})
+
+		var out MapClass
+		err = inst.Extract(&out)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, out, data)
+	})
+
+	t.Run("Assert struct", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		type Tagged struct {
+			Tags map[string]Symbol
+		}
+		fact, err := env.AssertStruct(Tagged{
+			Tags: map[string]Symbol{"env": "prod"},
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, fact.String(), "(Tagged (Tags env prod))")
+
+		var out Tagged
+		err = fact.Extract(&out)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, out.Tags, map[string]Symbol{"env": "prod"})
+	})
+
+	t.Run("Callbacks", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		callback := func(in map[string]int64) map[string]int64 {
+			out := make(map[string]int64, len(in))
+			for k, v := range in {
+				out[k] = v * 2
+			}
+			return out
+		}
+		err := env.DefineFunction("double", callback)
+		assert.NilError(t, err)
+
+		ret, err := env.Eval("(double (create$ a 1 b 2))")
+		assert.NilError(t, err)
+		assert.DeepEqual(t, ret, []interface{}{Symbol("a"), int64(2), Symbol("b"), int64(4)})
+	})
+}
@@ -0,0 +1,519 @@
+package clips
+
+// #cgo CFLAGS: -I ../../clips_source
+// #cgo LDFLAGS: -L ../../clips_source -l clips -lm
+// #include <clips/clips.h>
+//
+// void provenanceBeforeRunFunction(void *env, void *activation);
+// void provenanceRunFunction(void *env);
+// void provenanceResetFunction(void *env);
+// void *previous_fact(void *fact);
+//
+// void add_provenance_functions(void *env)
+// {
+//   EnvAddBeforeRunFunction(env, "go-provenance", provenanceBeforeRunFunction, 0);
+//   EnvAddRunFunction(env, "go-provenance", provenanceRunFunction, 0);
+//   EnvAddResetFunction(env, "go-provenance", provenanceResetFunction, 0);
+//   EnvAddClearFunction(env, "go-provenance", provenanceResetFunction, 0);
+// }
+//
+// void remove_provenance_functions(void *env)
+// {
+//   EnvRemoveBeforeRunFunction(env, "go-provenance");
+//   EnvRemoveRunFunction(env, "go-provenance");
+//   EnvRemoveResetFunction(env, "go-provenance");
+//   EnvRemoveClearFunction(env, "go-provenance");
+// }
+//
+// void *last_fact(void *env)
+// {
+//   return FactData(env)->LastFact;
+// }
+//
+// void *last_instance(void *env)
+// {
+//   return InstanceData(env)->InstanceListBottom;
+// }
+//
+// void *activation_rule(void *act)
+// {
+//   return ((struct activation *) act)->theRule;
+// }
+//
+// int activation_size(void *act)
+// {
+//   return ((struct activation *) act)->basis->bcount;
+// }
+//
+// void *activation_item(void *act, int i, int *type)
+// {
+//   struct alphaMatch *am = ((struct activation *) act)->basis->binds[i].gm.theMatch;
+//
+//   if ((am == NULL) || (am->matchingItem == NULL)) {
+//     return NULL;
+//   }
+//   *type = am->matchingItem->theInfo->base.type;
+//   return am->matchingItem;
+// }
+import "C"
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// DefaultProvenanceLimit is how many facts and instances provenance is kept for, unless changed by
+// SetProvenanceLimit
+const DefaultProvenanceLimit = 10000
+
+// Provenance records how a fact or instance came to be
+type Provenance struct {
+	// Rule is the name of the rule whose firing asserted the fact or made the instance, or "" if it
+	// was not made by a rule while tracking, e.g. asserted from Go or by deffacts
+	Rule string
+
+	// Basis is the activation basis of that firing: the facts and instances the rule matched. Those
+	// since retracted or deleted are nil
+	Basis PartialMatch
+
+	// Sequence numbers the rule firings since tracking was enabled, starting at 1
+	Sequence int64
+}
+
+// Explanation is a tree following the provenance of a fact or instance back to the facts and
+// instances that were not made by rules. It can be printed as text, or marshaled as JSON
+type Explanation struct {
+	// Item is the fact or instance as it was when made, e.g. f-3 (derived 1 5)
+	Item string `json:"item"`
+
+	// Rule and Sequence identify the rule firing that made the item, if any
+	Rule     string `json:"rule,omitempty"`
+	Sequence int64  `json:"sequence,omitempty"`
+
+	// Basis explains each fact and instance matched by that firing
+	Basis []*Explanation `json:"basis,omitempty"`
+}
+
+// provenanceTracker records the firing that made each fact and instance. The activation about to
+// fire is read before each firing, and the facts and instances it made after it
+type provenanceTracker struct {
+	env       *Environment
+	facts     map[int]*provenanceRecord
+	instances map[InstanceName]*provenanceRecord
+	// records in the order made, the oldest forgotten first once there are more than the limit
+	records  []*provenanceRecord
+	sequence int64
+	// the firing under way, the index of the last fact before it and the last instance before
+	// it, which is kept from being freed until the firing ends
+	current      *provenanceFiring
+	lastFact     int
+	lastInstance unsafe.Pointer
+	// the last firing whose instances could not be followed, reported by the next lookup
+	err error
+}
+
+// provenanceRef identifies a fact by its index, or an instance by its name, module and address,
+// without keeping either from being retracted or deleted. The address is only compared, never
+// followed
+type provenanceRef struct {
+	index   int
+	name    InstanceName
+	module  string
+	instptr uintptr
+}
+
+type provenanceRecord struct {
+	ref    provenanceRef
+	text   string
+	firing *provenanceFiring
+}
+
+type provenanceFiring struct {
+	rule     string
+	basis    []provenanceRef
+	sequence int64
+}
+
+// SetProvenanceTracking turns provenance tracking on or off. While it is on, the rule firing that
+// asserted each fact or made each instance is recorded, for Provenance and Explain. Only the index
+// of a fact and the name of an instance are kept, so tracking does not keep them from being
+// retracted or deleted. Records are kept for the most recent facts and instances, up to the limit
+// set by SetProvenanceLimit, until tracking is turned off, or the environment is reset or cleared
+func (env *Environment) SetProvenanceTracking(on bool) {
+	if on == (env.provenance != nil) {
+		return
+	}
+	if !on {
+		C.remove_provenance_functions(env.env)
+		env.provenance.forget()
+		env.provenance = nil
+		return
+	}
+	env.provenance = &provenanceTracker{
+		env:       env,
+		facts:     make(map[int]*provenanceRecord),
+		instances: make(map[InstanceName]*provenanceRecord),
+	}
+	C.add_provenance_functions(env.env)
+}
+
+// ProvenanceTracking returns true if provenance tracking is on
+func (env *Environment) ProvenanceTracking() bool {
+	return env.provenance != nil
+}
+
+// SetProvenanceLimit sets how many facts and instances provenance is kept for, the oldest being
+// forgotten first. A limit of 0 or less restores DefaultProvenanceLimit
+func (env *Environment) SetProvenanceLimit(limit int) {
+	if limit <= 0 {
+		limit = 0
+	}
+	env.provenanceLimit = limit
+	if env.provenance != nil {
+		env.provenance.evict()
+	}
+}
+
+// ProvenanceLimit returns how many facts and instances provenance is kept for
+func (env *Environment) ProvenanceLimit() int {
+	if env.provenanceLimit == 0 {
+		return DefaultProvenanceLimit
+	}
+	return env.provenanceLimit
+}
+
+// forget drops every record, as the facts and instances they are for are gone or no longer tracked
+func (t *provenanceTracker) forget() {
+	t.release()
+	t.records = nil
+	t.facts = make(map[int]*provenanceRecord)
+	t.instances = make(map[InstanceName]*provenanceRecord)
+	t.current = nil
+}
+
+// release lets the last instance before the firing under way be freed
+func (t *provenanceTracker) release() {
+	if t.lastInstance != nil {
+		C.EnvDecrementInstanceCount(t.env.env, t.lastInstance)
+		t.lastInstance = nil
+	}
+}
+
+// add keeps a new record, replacing any for the same fact or instance, and forgets the oldest
+// records past the limit
+func (t *provenanceTracker) add(rec *provenanceRecord) {
+	if rec.ref.name == "" {
+		t.facts[rec.ref.index] = rec
+	} else {
+		t.instances[rec.ref.name] = rec
+	}
+	t.records = append(t.records, rec)
+	t.evict()
+}
+
+func (t *provenanceTracker) evict() {
+	for len(t.records) > t.env.ProvenanceLimit() {
+		rec := t.records[0]
+		t.records[0] = nil
+		t.records = t.records[1:]
+		if rec.ref.name == "" {
+			if t.facts[rec.ref.index] == rec {
+				delete(t.facts, rec.ref.index)
+			}
+		} else if t.instances[rec.ref.name] == rec {
+			delete(t.instances, rec.ref.name)
+		}
+	}
+}
+
+// before reads the rule and basis of the activation about to fire, and notes where the facts and
+// instances it makes will start
+func (t *provenanceTracker) before(actptr unsafe.Pointer) {
+	env := t.env
+	// the previous firing did not end normally
+	t.release()
+
+	t.sequence++
+	firing := &provenanceFiring{
+		rule:     createRule(env, C.activation_rule(actptr)).Name(),
+		sequence: t.sequence,
+	}
+	size := int(C.activation_size(actptr))
+	for ii := 0; ii < size; ii++ {
+		var typ C.int
+		item := C.activation_item(actptr, C.int(ii), &typ)
+		if item == nil {
+			// a pattern with nothing to match, such as a not CE
+			continue
+		}
+		switch typ {
+		case C.FACT_ADDRESS:
+			firing.basis = append(firing.basis, provenanceRef{index: int(C.EnvFactIndex(env.env, item))})
+		case C.INSTANCE_ADDRESS:
+			firing.basis = append(firing.basis, instanceRef(env, item))
+		}
+	}
+	t.current = firing
+
+	t.lastFact = 0
+	if factptr := C.last_fact(env.env); factptr != nil {
+		t.lastFact = int(C.EnvFactIndex(env.env, factptr))
+	}
+	t.lastInstance = C.last_instance(env.env)
+	if t.lastInstance != nil {
+		C.EnvIncrementInstanceCount(env.env, t.lastInstance)
+	}
+}
+
+// after records the facts and instances made by the firing that has just ended. New facts have
+// the highest indices, and new instances follow the last instance before the firing
+func (t *provenanceTracker) after() {
+	env := t.env
+	firing := t.current
+	if firing == nil {
+		return
+	}
+	t.current = nil
+
+	var made []*provenanceRecord
+	for factptr := C.last_fact(env.env); factptr != nil; factptr = C.previous_fact(factptr) {
+		index := int(C.EnvFactIndex(env.env, factptr))
+		if index <= t.lastFact {
+			break
+		}
+		made = append(made, &provenanceRecord{
+			ref:    provenanceRef{index: index},
+			text:   factText(env, factptr),
+			firing: firing,
+		})
+	}
+	for ii := len(made) - 1; ii >= 0; ii-- {
+		t.add(made[ii])
+	}
+
+	var instptr unsafe.Pointer
+	if t.lastInstance == nil {
+		instptr = C.EnvGetNextInstance(env.env, nil)
+	} else if C.EnvValidInstanceAddress(env.env, t.lastInstance) == 1 {
+		instptr = C.EnvGetNextInstance(env.env, t.lastInstance)
+	} else {
+		t.err = fmt.Errorf("Unable to follow the instances made by firing %d of %s, as the last instance before it was deleted",
+			firing.sequence, firing.rule)
+	}
+	for ; instptr != nil; instptr = C.EnvGetNextInstance(env.env, instptr) {
+		t.add(&provenanceRecord{
+			ref:    instanceRef(env, instptr),
+			text:   instanceText(env, instptr),
+			firing: firing,
+		})
+	}
+	t.release()
+}
+
+func instanceRef(env *Environment, instptr unsafe.Pointer) provenanceRef {
+	clptr := C.EnvGetInstanceClass(env.env, instptr)
+	return provenanceRef{
+		name:    InstanceName(C.GoString(C.EnvGetInstanceName(env.env, instptr))),
+		module:  C.GoString(C.EnvDefclassModule(env.env, clptr)),
+		instptr: uintptr(instptr),
+	}
+}
+
+// factText returns the fact as it is printed by the facts command, e.g. f-3 (derived 1 5)
+func factText(env *Environment, factptr unsafe.Pointer) string {
+	split := strings.SplitN(factPPString(env, factptr), "     ", 2)
+	return fmt.Sprintf("f-%d %s", int(C.EnvFactIndex(env.env, factptr)), strings.TrimRight(split[len(split)-1], "\n"))
+}
+
+// instanceText returns the instance's name and class, e.g. [d] of Derived
+func instanceText(env *Environment, instptr unsafe.Pointer) string {
+	clptr := C.EnvGetInstanceClass(env.env, instptr)
+	return fmt.Sprintf("[%s] of %s", C.GoString(C.EnvGetInstanceName(env.env, instptr)),
+		C.GoString(C.EnvGetDefclassName(env.env, clptr)))
+}
+
+// Provenance returns how the given fact or instance was made. If the instances made by a firing
+// could not be followed since the last lookup, that error is returned instead. Facts in the basis
+// are found by walking back from the most recently asserted fact, so older ones take longer
+func (env *Environment) Provenance(item interface{}) (*Provenance, error) {
+	rec, err := env.provenanceRecordFor(item)
+	if err != nil {
+		return nil, err
+	}
+	ret := &Provenance{}
+	if rec.firing != nil {
+		ret.Rule = rec.firing.rule
+		ret.Sequence = rec.firing.sequence
+		ret.Basis = make(PartialMatch, len(rec.firing.basis))
+		for ii, ref := range rec.firing.basis {
+			if factptr := env.recentFact(ref); factptr != nil {
+				ret.Basis[ii] = env.newFact(factptr)
+			} else if instptr := env.liveInstance(ref); instptr != nil {
+				ret.Basis[ii] = createInstance(env, instptr)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// Explain follows the provenance of the given fact or instance back to facts and instances that
+// were not made by rules, such as those asserted from Go or by deffacts. Items whose records have
+// been forgotten are not followed further. Like Provenance, it reports instances that could not
+// be followed
+func (env *Environment) Explain(item interface{}) (*Explanation, error) {
+	rec, err := env.provenanceRecordFor(item)
+	if err != nil {
+		return nil, err
+	}
+	return env.provenance.explain(rec), nil
+}
+
+func (env *Environment) provenanceRecordFor(item interface{}) (*provenanceRecord, error) {
+	if env.provenance == nil {
+		return nil, fmt.Errorf("Provenance tracking is not enabled")
+	}
+	if err := env.provenance.err; err != nil {
+		env.provenance.err = nil
+		return nil, err
+	}
+	var ref provenanceRef
+	switch v := item.(type) {
+	case *TemplateFact:
+		if err := checkFact(env, v.factptr); err != nil {
+			return nil, err
+		}
+		ref = provenanceRef{index: v.Index()}
+	case *ImpliedFact:
+		if err := checkFact(env, v.factptr); err != nil {
+			return nil, err
+		}
+		ref = provenanceRef{index: v.Index()}
+	case *Instance:
+		if err := checkInstance(env, v.instptr); err != nil {
+			return nil, err
+		}
+		ref = instanceRef(env, v.instptr)
+	default:
+		return nil, fmt.Errorf("Unable to find provenance of %T, expected a fact or an instance", item)
+	}
+	if rec := env.provenance.record(ref); rec != nil {
+		return rec, nil
+	}
+	// not made by a rule while tracking
+	return &provenanceRecord{
+		ref:  ref,
+		text: env.provenance.text(ref),
+	}, nil
+}
+
+// record returns the record for a fact or instance, or nil if there is none
+func (t *provenanceTracker) record(ref provenanceRef) *provenanceRecord {
+	if ref.name == "" {
+		return t.facts[ref.index]
+	}
+	if rec, ok := t.instances[ref.name]; ok && rec.ref.instptr == ref.instptr {
+		return rec
+	}
+	return nil
+}
+
+// text describes a fact or instance with no record, by its index or name alone once it is gone
+func (t *provenanceTracker) text(ref provenanceRef) string {
+	if factptr := t.env.recentFact(ref); factptr != nil {
+		return factText(t.env, factptr)
+	}
+	if instptr := t.env.liveInstance(ref); instptr != nil {
+		return instanceText(t.env, instptr)
+	}
+	if ref.name == "" {
+		return fmt.Sprintf("f-%d", ref.index)
+	}
+	return fmt.Sprintf("[%s]", ref.name)
+}
+
+// recentFact returns the asserted fact with the referenced index, walking back from the last
+// fact, or nil if the reference is to an instance or the fact has been retracted
+func (env *Environment) recentFact(ref provenanceRef) unsafe.Pointer {
+	if ref.name != "" {
+		return nil
+	}
+	for factptr := C.last_fact(env.env); factptr != nil; factptr = C.previous_fact(factptr) {
+		index := int(C.EnvFactIndex(env.env, factptr))
+		if index == ref.index {
+			return factptr
+		}
+		if index < ref.index {
+			break
+		}
+	}
+	return nil
+}
+
+// liveInstance returns the referenced instance, or nil if it has been deleted, even if another
+// has since been made with the same name
+func (env *Environment) liveInstance(ref provenanceRef) unsafe.Pointer {
+	if ref.name == "" {
+		return nil
+	}
+	inst, err := env.FindInstance(ref.name, ref.module)
+	if err != nil {
+		return nil
+	}
+	defer inst.Drop()
+	if uintptr(inst.instptr) != ref.instptr {
+		return nil
+	}
+	return inst.instptr
+}
+
+func (t *provenanceTracker) explain(rec *provenanceRecord) *Explanation {
+	ret := &Explanation{
+		Item: rec.text,
+	}
+	if rec.firing != nil {
+		ret.Rule = rec.firing.rule
+		ret.Sequence = rec.firing.sequence
+		for _, ref := range rec.firing.basis {
+			if basis := t.record(ref); basis != nil {
+				ret.Basis = append(ret.Basis, t.explain(basis))
+			} else {
+				ret.Basis = append(ret.Basis, &Explanation{Item: t.text(ref)})
+			}
+		}
+	}
+	return ret
+}
+
+// String returns the explanation as an indented tree, one item per line
+func (e *Explanation) String() string {
+	var buf strings.Builder
+	e.write(&buf, 0)
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+func (e *Explanation) write(buf *strings.Builder, depth int) {
+	buf.WriteString(strings.Repeat("  ", depth))
+	buf.WriteString(e.Item)
+	if e.Rule != "" {
+		fmt.Fprintf(buf, " <- %s (firing %d)", e.Rule, e.Sequence)
+	}
+	buf.WriteString("\n")
+	for _, basis := range e.Basis {
+		basis.write(buf, depth+1)
+	}
+}
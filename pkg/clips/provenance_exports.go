@@ -0,0 +1,49 @@
+package clips
+
+// #cgo CFLAGS: -I ../../clips_source
+// #cgo LDFLAGS: -L ../../clips_source -l clips -lm
+// #include <clips/clips.h>
+import "C"
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import "unsafe"
+
+//export provenanceResetFunction
+func provenanceResetFunction(envptr unsafe.Pointer) {
+	env, ok := environmentFor(envptr)
+	if !ok || env.provenance == nil {
+		return
+	}
+	env.provenance.forget()
+}
+
+//export provenanceBeforeRunFunction
+func provenanceBeforeRunFunction(envptr unsafe.Pointer, actptr unsafe.Pointer) {
+	env, ok := environmentFor(envptr)
+	if !ok || env.provenance == nil {
+		return
+	}
+	env.provenance.before(actptr)
+}
+
+//export provenanceRunFunction
+func provenanceRunFunction(envptr unsafe.Pointer) {
+	env, ok := environmentFor(envptr)
+	if !ok || env.provenance == nil {
+		return
+	}
+	env.provenance.after()
+}
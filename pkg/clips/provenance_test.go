@@ -0,0 +1,255 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestProvenance(t *testing.T) {
+	t.Run("Facts", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := env.Provenance(nil)
+		assert.ErrorContains(t, err, "not enabled")
+
+		env.SetProvenanceTracking(true)
+		assert.Assert(t, env.ProvenanceTracking())
+		err = env.Build(`(defrule derive (source ?x) => (assert (derived ?x)))`)
+		assert.NilError(t, err)
+		err = env.Build(`(defrule combine (derived ?x) (source ?x) => (assert (combined ?x)))`)
+		assert.NilError(t, err)
+
+		source, err := env.AssertString(`(source 1)`)
+		assert.NilError(t, err)
+		assert.Equal(t, env.Run(-1), int64(2))
+
+		prov, err := env.Provenance(source)
+		assert.NilError(t, err)
+		assert.Equal(t, prov.Rule, "")
+
+		derived, err := env.FactByIndex(source.Index() + 1)
+		assert.NilError(t, err)
+		prov, err = env.Provenance(derived)
+		assert.NilError(t, err)
+		assert.Equal(t, prov.Rule, "derive")
+		assert.Equal(t, prov.Sequence, int64(1))
+		assert.Equal(t, len(prov.Basis), 1)
+		assert.Assert(t, prov.Basis[0].(Fact).Equal(source))
+
+		combined, err := env.FactByIndex(source.Index() + 2)
+		assert.NilError(t, err)
+		explained, err := env.Explain(combined)
+		assert.NilError(t, err)
+		assert.Equal(t, explained.Rule, "combine")
+		assert.Equal(t, explained.Sequence, int64(2))
+		assert.Equal(t, len(explained.Basis), 2)
+		assert.Equal(t, explained.Basis[0].Rule, "derive")
+		assert.Equal(t, explained.Basis[0].Basis[0].Item, explained.Basis[1].Item)
+		assert.Equal(t, explained.String(), `f-3 (combined 1) <- combine (firing 2)
+  f-2 (derived 1) <- derive (firing 1)
+    f-1 (source 1)
+  f-1 (source 1)`)
+
+		out, err := json.Marshal(explained.Basis[1])
+		assert.NilError(t, err)
+		assert.Equal(t, string(out), `{"item":"f-1 (source 1)"}`)
+
+		env.SetProvenanceTracking(false)
+		assert.Assert(t, !env.ProvenanceTracking())
+		_, err = env.Explain(combined)
+		assert.ErrorContains(t, err, "not enabled")
+	})
+
+	t.Run("Instances", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		env.SetProvenanceTracking(true)
+		err := env.Build(`(defclass Derived (is-a USER) (slot value))`)
+		assert.NilError(t, err)
+		err = env.Build(`(defrule make-derived (source ?x) => (make-instance d of Derived (value ?x)))`)
+		assert.NilError(t, err)
+
+		_, err = env.AssertString(`(source 1)`)
+		assert.NilError(t, err)
+		env.Run(-1)
+
+		inst, err := env.FindInstance("d", "")
+		assert.NilError(t, err)
+		explained, err := env.Explain(inst)
+		assert.NilError(t, err)
+		assert.Equal(t, explained.Item, "[d] of Derived")
+		assert.Equal(t, explained.Rule, "make-derived")
+		assert.Equal(t, len(explained.Basis), 1)
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		env.SetProvenanceTracking(true)
+		err := env.Build(`(defrule derive (source ?x) => (assert (derived ?x)))`)
+		assert.NilError(t, err)
+		_, err = env.AssertString(`(source 1)`)
+		assert.NilError(t, err)
+		env.Run(-1)
+
+		env.Reset()
+		source, err := env.AssertString(`(source 2)`)
+		assert.NilError(t, err)
+		env.Run(-1)
+
+		derived, err := env.FactByIndex(source.Index() + 1)
+		assert.NilError(t, err)
+		explained, err := env.Explain(derived)
+		assert.NilError(t, err)
+		assert.Equal(t, len(explained.Basis), 1)
+		assert.Equal(t, explained.Basis[0].Item, fmt.Sprintf("f-%d (source 2)", source.Index()))
+	})
+
+	t.Run("No handles kept", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		env.SetProvenanceTracking(true)
+		err := env.Build(`(defrule derive (source ?x) => (assert (derived ?x)))`)
+		assert.NilError(t, err)
+		fact, err := env.AssertString(`(source 1)`)
+		assert.NilError(t, err)
+		factptr := fact.(*ImpliedFact).factptr
+		count := factBusyCount(factptr)
+
+		env.Run(-1)
+		assert.Equal(t, factBusyCount(factptr), count)
+		prov, err := env.Provenance(fact)
+		assert.NilError(t, err)
+		assert.Equal(t, prov.Rule, "")
+		assert.Equal(t, factBusyCount(factptr), count)
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		assert.Equal(t, env.ProvenanceLimit(), DefaultProvenanceLimit)
+		env.SetProvenanceTracking(true)
+		env.SetProvenanceLimit(2)
+		assert.Equal(t, env.ProvenanceLimit(), 2)
+		err := env.Build(`(defrule derive (source ?x) => (assert (derived ?x)))`)
+		assert.NilError(t, err)
+		var last Fact
+		for ii := 1; ii <= 3; ii++ {
+			last, err = env.AssertString(fmt.Sprintf(`(source %d)`, ii))
+			assert.NilError(t, err)
+		}
+		assert.Equal(t, env.Run(-1), int64(3))
+
+		first, err := env.FactByIndex(last.Index() + 1)
+		assert.NilError(t, err)
+		prov, err := env.Provenance(first)
+		assert.NilError(t, err)
+		assert.Equal(t, prov.Rule, "")
+
+		newest, err := env.FactByIndex(last.Index() + 3)
+		assert.NilError(t, err)
+		prov, err = env.Provenance(newest)
+		assert.NilError(t, err)
+		assert.Equal(t, prov.Rule, "derive")
+		assert.Equal(t, prov.Sequence, int64(3))
+
+		env.SetProvenanceLimit(0)
+		assert.Equal(t, env.ProvenanceLimit(), DefaultProvenanceLimit)
+	})
+
+	t.Run("Multi-line strings", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		env.SetProvenanceTracking(true)
+		err := env.Build(`(defrule derive (source ?x) => (assert (derived (str-cat ?x "
+done"))))`)
+		assert.NilError(t, err)
+		source, err := env.AssertString(`(source "first
+second")`)
+		assert.NilError(t, err)
+		env.Run(-1)
+
+		derived, err := env.FactByIndex(source.Index() + 1)
+		assert.NilError(t, err)
+		explained, err := env.Explain(derived)
+		assert.NilError(t, err)
+		assert.Equal(t, explained.Rule, "derive")
+		assert.Equal(t, len(explained.Basis), 1)
+		assert.Equal(t, explained.Basis[0].Item, fmt.Sprintf("f-%d %s", source.Index(), source.String()))
+	})
+
+	t.Run("Other modules", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		env.SetProvenanceTracking(true)
+		err := env.Build(`(defmodule MAIN (export ?ALL))`)
+		assert.NilError(t, err)
+		err = env.Build(`(deftemplate MAIN::source (slot x))`)
+		assert.NilError(t, err)
+		err = env.Build(`(defmodule OTHER (import MAIN ?ALL))`)
+		assert.NilError(t, err)
+		err = env.Build(`(defclass OTHER::Thing (is-a USER))`)
+		assert.NilError(t, err)
+		err = env.Build(`(defrule OTHER::make (source (x ?x)) => (make-instance t of Thing))`)
+		assert.NilError(t, err)
+
+		source, err := env.AssertString(`(source (x 1))`)
+		assert.NilError(t, err)
+		err = env.SendCommand(`(focus OTHER)`)
+		assert.NilError(t, err)
+		assert.Equal(t, env.Run(-1), int64(1))
+
+		inst, err := env.FindInstance("t", "OTHER")
+		assert.NilError(t, err)
+		prov, err := env.Provenance(inst)
+		assert.NilError(t, err)
+		assert.Equal(t, prov.Rule, "make")
+		assert.Equal(t, len(prov.Basis), 1)
+		assert.Assert(t, prov.Basis[0].(Fact).Equal(source))
+	})
+
+	t.Run("Watches untouched", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		env.SetProvenanceTracking(true)
+		err := env.Build(`(defrule derive (source ?x) => (assert (derived ?x)))`)
+		assert.NilError(t, err)
+		out, err := env.Capture(func() error {
+			if _, err := env.AssertString(`(source 1)`); err != nil {
+				return err
+			}
+			env.Run(-1)
+			return nil
+		}, "wtrace")
+		assert.NilError(t, err)
+		assert.Equal(t, out, "")
+
+		_, err = env.Explain("f-1")
+		assert.ErrorContains(t, err, "expected a fact or an instance")
+	})
+}
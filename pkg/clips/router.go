@@ -147,6 +147,7 @@ func (r *RouterCore) Deactivate() error {
 // Delete deletes the router from the environment
 func (r *RouterCore) Delete() error {
 	defer C.free(unsafe.Pointer(r.routername))
+	delete(r.env.router, r.name)
 	errcode := int(C.EnvDeleteRouter(r.env.env, r.routername))
 	if errcode != 1 {
 		return EnvError(r.env, "Failed to delete router")
@@ -23,7 +23,7 @@ import "C"
 import "unsafe"
 
 func lookupRouter(envptr unsafe.Pointer) Router {
-	env := environmentObj[envptr]
+	env, _ := environmentFor(envptr)
 	routername := C.GoString(C.getNameFromContext(envptr))
 	return env.router[routername]
 }
@@ -46,7 +46,15 @@ func printFunction(envptr unsafe.Pointer, name *C.char, message *C.char) C.int {
 
 //export getcFunction
 func getcFunction(envptr unsafe.Pointer, name *C.char) C.int {
-	return C.int(lookupRouter(envptr).Getc(C.GoString(name)))
+	router := lookupRouter(envptr)
+	if input, ok := router.(InputRouter); ok {
+		ch, err := input.ReadChar(C.GoString(name))
+		if err != nil {
+			return C.EOF
+		}
+		return C.int(ch)
+	}
+	return C.int(router.Getc(C.GoString(name)))
 }
 
 //export ungetcFunction
@@ -224,12 +224,17 @@ func (env *Environment) ClearFocus() {
 	C.EnvClearFocusStack(env.env)
 }
 
-// Run runs the activations in the agenda. If limit is not negative, only the first activations up to the limit will be run
+// Run runs the activations in the agenda. If limit is not negative, only the first activations up to the limit will be run.
+// Expired facts are retracted first; see ExpiryError. Instances bound to Go structs are refreshed afterwards
 func (env *Environment) Run(limit int64) int64 {
 	if limit < 0 {
 		limit = -1
 	}
+	if env.expiry != nil {
+		env.expiry.sweepAndRecord(env)
+	}
 	ret := C.EnvRun(env.env, C.longlong(limit))
+	env.refreshBound()
 	return int64(ret)
 }
 
@@ -21,6 +21,7 @@ import "C"
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 )
 
@@ -30,6 +31,14 @@ type InsertClassOption string
 const (
 	// DoNotRestrictAllowedClasses prevents the class insertion from using an allowed-class constraint for instance-name slots. Primarily useful if [nil] must be allowed
 	DoNotRestrictAllowedClasses InsertClassOption = "DoNotRestrictAllowedClasses"
+
+	// EmbedAsSuperclass makes the classes of embedded structs superclasses of the inserted class,
+	// rather than copying their slots into it. The class also inherits from the abstract class of
+	// each inserted interface that the struct implements
+	EmbedAsSuperclass InsertClassOption = "EmbedAsSuperclass"
+
+	// BindInstance keeps an instance created by Insert linked to the Go struct it was created from. The struct must be passed by pointer. See Instance.Sync and Instance.Refresh
+	BindInstance InsertClassOption = "BindInstance"
 )
 
 // InsertClass creates a representation of a Go struct as a CLIPS defclass
@@ -77,17 +86,49 @@ func classNameFor(typ reflect.Type) (string, error) {
 }
 
 func (env *Environment) insertShadowClass(classname string, typ reflect.Type, opts ...InsertClassOption) error {
+	if typ.Kind() == reflect.Interface {
+		// an interface has no slots, but structs implementing it may inherit from it
+		if err := env.Build(fmt.Sprintf(`(defclass %s (is-a USER) (role abstract))`, classname)); err != nil {
+			return err
+		}
+		env.interfaces[classname] = typ
+		return nil
+	}
+	superclasses := "USER"
+	embedAsSuperclass := hasOption(opts, EmbedAsSuperclass)
+	if embedAsSuperclass {
+		supers, err := env.superclassesFor(typ, opts...)
+		if err != nil {
+			return err
+		}
+		if len(supers) > 0 {
+			superclasses = strings.Join(supers, " ")
+		}
+		if _, err := env.FindClass(classname); err == nil {
+			// a superclass referred back to this class, so it has already been inserted
+			return nil
+		}
+	}
 	// first, build effectively a forward declaration, so we don't get into
 	// infinite recursion if some field references this class. That lookup
 	// will succeed.
-	if err := env.Build(fmt.Sprintf(`(defclass %s (is-a USER))`, classname)); err != nil {
+	facets := ""
+	if superclasses != "USER" {
+		// role and reactivity are otherwise inherited, and an interface superclass is abstract
+		facets = " (role concrete) (pattern-match reactive)"
+	}
+	if err := env.Build(fmt.Sprintf(`(defclass %s (is-a %s)%s)`, classname, superclasses, facets)); err != nil {
 		return err
 	}
 	// Now, we'll override with a full definition
 	var defclass strings.Builder
-	fmt.Fprintf(&defclass, "(defclass %s (is-a USER)\n", classname)
+	fmt.Fprintf(&defclass, "(defclass %s (is-a %s)%s\n", classname, superclasses, facets)
 	for ii := 0; ii < typ.NumField(); ii++ {
 		field := typ.Field(ii)
+		if _, ok := embeddedStruct(field); ok && embedAsSuperclass {
+			// slots are inherited from the superclass
+			continue
+		}
 
 		if err := env.defclassSlots(&defclass, field, opts...); err != nil {
 			return err
@@ -98,30 +139,100 @@ func (env *Environment) insertShadowClass(classname string, typ reflect.Type, op
 	return env.Build(buildcmd)
 }
 
+// superclassesFor inserts the classes of the structs embedded in typ, and returns their names along
+// with those of the inserted interfaces typ implements
+func (env *Environment) superclassesFor(typ reflect.Type, opts ...InsertClassOption) ([]string, error) {
+	ret := make([]string, 0)
+	supers := make([]*Class, 0)
+	for ii := 0; ii < typ.NumField(); ii++ {
+		embedded, ok := embeddedStruct(typ.Field(ii))
+		if !ok {
+			continue
+		}
+		classname, err := classNameFor(embedded)
+		if err != nil {
+			return nil, err
+		}
+		cls, err := env.checkRecurseClass(classname, embedded, opts...)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, classname)
+		supers = append(supers, cls)
+	}
+
+	names := make([]string, 0, len(env.interfaces))
+	for name := range env.interfaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		iface := env.interfaces[name]
+		if !typ.Implements(iface) && !reflect.PtrTo(typ).Implements(iface) {
+			continue
+		}
+		ifaceClass, err := env.FindClass(name)
+		if err != nil {
+			return nil, err
+		}
+		inherited := false
+		for _, cls := range supers {
+			if cls.Equal(ifaceClass) || cls.Subclass(ifaceClass) {
+				inherited = true
+				break
+			}
+		}
+		if !inherited {
+			ret = append(ret, name)
+		}
+	}
+	return ret, nil
+}
+
+// embeddedStruct returns the struct type of an anonymous field, which may be a pointer to a struct
+func embeddedStruct(field reflect.StructField) (reflect.Type, bool) {
+	if !field.Anonymous {
+		return nil, false
+	}
+	typ := field.Type
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ, typ.Kind() == reflect.Struct
+}
+
 func (env *Environment) defclassSlots(defclass *strings.Builder, field reflect.StructField, opts ...InsertClassOption) error {
-	if field.Anonymous {
+	if embedded, ok := embeddedStruct(field); ok {
 		// treat fields of the anonymous class just like they are native
-		for ii := 0; ii < field.Type.NumField(); ii++ {
-			if err := env.defclassSlots(defclass, field.Type.Field(ii)); err != nil {
+		for ii := 0; ii < embedded.NumField(); ii++ {
+			if err := env.defclassSlots(defclass, embedded.Field(ii), opts...); err != nil {
 				return err
 			}
 		}
 		return nil
 	}
+	tag := slotTagFor(field)
+	if tag.omit {
+		return nil
+	}
+	if conv, ok := env.fieldConverter(field.Type); ok {
+		fmt.Fprintf(defclass, "    (slot %s%s)\n", tag.name, tag.slotFacets(tag.convertedType(conv), field.Type.Kind() == reflect.Ptr, env.nilSymbol))
+		return nil
+	}
 	fieldtype := field.Type
 	if fieldtype.Kind() == reflect.Ptr {
 		fieldtype = fieldtype.Elem()
 	}
 	switch fieldtype.Kind() {
 	case reflect.Interface:
-		fmt.Fprintf(defclass, "    (slot %s (type ?VARIABLE))\n", slotNameFor(field))
+		fmt.Fprintf(defclass, "    (slot %s (type ?VARIABLE)%s)\n", tag.name, tag.facets(""))
 		return nil
 	case reflect.Struct:
 		classname, err := classNameFor(fieldtype)
 		if err != nil {
 			return err
 		}
-		if _, err = env.checkRecurseClass(classname, fieldtype); err != nil {
+		if _, err = env.checkRecurseClass(classname, fieldtype, opts...); err != nil {
 			return err
 		}
 		allowed := fmt.Sprintf(" (allowed-classes %s)", classname)
@@ -131,12 +242,20 @@ func (env *Environment) defclassSlots(defclass *strings.Builder, field reflect.S
 				allowed = ""
 			}
 		}
-		fmt.Fprintf(defclass, "    (slot %s (type INSTANCE-NAME)%s)\n", slotNameFor(field), allowed)
+		fmt.Fprintf(defclass, "    (slot %s (type INSTANCE-NAME)%s%s)\n", tag.name, allowed, tag.facets(INSTANCE_NAME.String()))
+		return nil
+	case reflect.Map:
+		facets, err := env.mapFacets(fieldtype)
+		if err != nil {
+			return fmt.Errorf(`Unable to represent type for field "%s": %v`, field.Name, err)
+		}
+		fmt.Fprintf(defclass, "    (multislot %s%s)\n", tag.name, facets)
 		return nil
 	case reflect.Array, reflect.Slice:
 		// don't handle here
 	default:
-		fmt.Fprintf(defclass, "    (slot %s (type %s))\n", slotNameFor(field), clipsTypeFor(fieldtype))
+		clipsType := env.overflowType(fieldtype, tag.slotType(fieldtype))
+		fmt.Fprintf(defclass, "    (slot %s%s)\n", tag.name, tag.slotFacets(clipsType, field.Type.Kind() == reflect.Ptr, env.nilSymbol))
 		return nil
 	}
 
@@ -145,8 +264,13 @@ func (env *Environment) defclassSlots(defclass *strings.Builder, field reflect.S
 		subtype = subtype.Elem()
 	}
 	var clipsSubtype string
+	if conv, ok := env.fieldConverter(fieldtype.Elem()); ok {
+		clipsSubtype = tag.convertedType(conv)
+		fmt.Fprintf(defclass, "    (multislot %s (type %s)%s)\n", tag.name, clipsSubtype, tag.facets(clipsSubtype))
+		return nil
+	}
 	switch subtype.Kind() {
-	case reflect.Array, reflect.Slice:
+	case reflect.Array, reflect.Slice, reflect.Map:
 		return fmt.Errorf(`Unable to represent type for field "%s"`, field.Name)
 	case reflect.Interface:
 		clipsSubtype = "?VARIABLE"
@@ -155,19 +279,24 @@ func (env *Environment) defclassSlots(defclass *strings.Builder, field reflect.S
 		if err != nil {
 			return err
 		}
-		if _, err = env.checkRecurseClass(classname, subtype); err != nil {
+		if _, err = env.checkRecurseClass(classname, subtype, opts...); err != nil {
 			return err
 		}
-		fmt.Fprintf(defclass, "    (multislot %s (type INSTANCE-NAME) (allowed-classes %s))\n", slotNameFor(field), subtype.Name())
+		fmt.Fprintf(defclass, "    (multislot %s (type INSTANCE-NAME) (allowed-classes %s))\n", tag.name, subtype.Name())
 		return nil
 	default:
-		clipsSubtype = clipsTypeFor(subtype).String()
+		clipsSubtype = env.overflowType(subtype, tag.slotType(subtype))
 	}
-	fmt.Fprintf(defclass, "    (multislot %s (type %s))\n", slotNameFor(field), clipsSubtype)
+	fmt.Fprintf(defclass, "    (multislot %s (type %s)%s)\n", tag.name, clipsSubtype, tag.facets(clipsSubtype))
 	return nil
 }
 
 func (env *Environment) checkRecurseClass(classname string, fieldtype reflect.Type, opts ...InsertClassOption) (*Class, error) {
+	if env.batch != nil {
+		if cls, ok := env.batch.classes[classname]; ok {
+			return cls, nil
+		}
+	}
 	cls, err := env.FindClass(classname)
 	if err != nil {
 		if _, ok := err.(NotFoundError); !ok {
@@ -178,5 +307,8 @@ func (env *Environment) checkRecurseClass(classname string, fieldtype reflect.Ty
 			return nil, err
 		}
 	}
+	if env.batch != nil {
+		env.batch.classes[classname] = cls
+	}
 	return cls, nil
 }
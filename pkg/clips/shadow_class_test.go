@@ -447,3 +447,177 @@ func TestInsertFields(t *testing.T) {
 		assert.DeepEqual(t, ret, &compare)
 	})
 }
+
+type Speaker interface {
+	Speak() string
+}
+
+type Animal struct {
+	Name string
+	Legs int
+}
+
+type Dog struct {
+	Animal
+	Breed string
+}
+
+func (d *Dog) Speak() string {
+	return "Woof"
+}
+
+type Puppy struct {
+	*Dog
+	Age int
+}
+
+type Robot struct {
+	Model string
+}
+
+func (r Robot) Speak() string {
+	return "Beep"
+}
+
+func TestInsertSuperclass(t *testing.T) {
+	t.Run("Embedded struct as superclass", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		cls, err := env.InsertClass((*Dog)(nil), EmbedAsSuperclass)
+		assert.NilError(t, err)
+
+		animal, err := env.FindClass("Animal")
+		assert.NilError(t, err)
+		assert.Assert(t, cls.Subclass(animal))
+
+		slots := cls.Slots(false)
+		assert.Equal(t, len(slots), 1)
+		assert.Equal(t, slots[0].Name(), "Breed")
+		assert.Equal(t, len(cls.Slots(true)), 3)
+	})
+
+	t.Run("Nested struct with option", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		type Kennel struct {
+			Resident Dog
+		}
+		_, err := env.Insert("kennel", Kennel{
+			Resident: Dog{Animal: Animal{Name: "Rex", Legs: 4}, Breed: "Beagle"},
+		}, EmbedAsSuperclass)
+		assert.NilError(t, err)
+
+		dog, err := env.FindClass("Dog")
+		assert.NilError(t, err)
+		animal, err := env.FindClass("Animal")
+		assert.NilError(t, err)
+		assert.Assert(t, dog.Subclass(animal))
+	})
+
+	t.Run("Embedded struct without option", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		cls, err := env.InsertClass((*Dog)(nil))
+		assert.NilError(t, err)
+		assert.Equal(t, len(cls.Slots(false)), 3)
+
+		_, err = env.FindClass("Animal")
+		assert.ErrorContains(t, err, "not found")
+	})
+
+	t.Run("Interface as abstract class", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		speaker, err := env.InsertClass((*Speaker)(nil))
+		assert.NilError(t, err)
+		assert.Assert(t, speaker.Abstract())
+
+		dog, err := env.InsertClass((*Dog)(nil), EmbedAsSuperclass)
+		assert.NilError(t, err)
+		assert.Assert(t, dog.Subclass(speaker))
+
+		// Animal does not implement Speaker
+		animal, err := env.FindClass("Animal")
+		assert.NilError(t, err)
+		assert.Assert(t, !animal.Subclass(speaker))
+
+		// Puppy embeds Dog, so inherits Speaker through it
+		puppy, err := env.InsertClass((*Puppy)(nil), EmbedAsSuperclass)
+		assert.NilError(t, err)
+		assert.Assert(t, puppy.Subclass(dog))
+		assert.Assert(t, puppy.Subclass(speaker))
+		supers, err := puppy.Superclasses(false)
+		assert.NilError(t, err)
+		assert.Equal(t, len(supers), 1)
+	})
+
+	t.Run("Interface as only superclass", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		speaker, err := env.InsertClass((*Speaker)(nil))
+		assert.NilError(t, err)
+		robot, err := env.InsertClass(Robot{}, EmbedAsSuperclass)
+		assert.NilError(t, err)
+		assert.Assert(t, robot.Subclass(speaker))
+		assert.Assert(t, !robot.Abstract())
+		assert.Assert(t, robot.Reactive())
+
+		err = env.Build(`(defrule speakers (object (is-a Speaker) (name ?name)) => (assert (speaker ?name)))`)
+		assert.NilError(t, err)
+		_, err = env.Insert("r2", &Robot{Model: "R2"}, EmbedAsSuperclass)
+		assert.NilError(t, err)
+		assert.Equal(t, env.Run(-1), int64(1))
+	})
+
+	t.Run("Rules match superclass", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := env.Insert("rex", &Dog{
+			Animal: Animal{
+				Name: "Rex",
+				Legs: 4,
+			},
+			Breed: "Beagle",
+		}, EmbedAsSuperclass)
+		assert.NilError(t, err)
+
+		err = env.Build(`(defrule count-legs
+			(object (is-a Animal) (Name ?name) (Legs ?legs))
+			=>
+			(assert (legs ?name ?legs)))`)
+		assert.NilError(t, err)
+		assert.Equal(t, env.Run(-1), int64(1))
+
+		facts := env.Facts()
+		assert.Equal(t, facts[len(facts)-1].String(), `(legs "Rex" 4)`)
+	})
+
+	t.Run("Extract embedded struct", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		data := Puppy{
+			Dog: &Dog{
+				Animal: Animal{
+					Name: "Rex",
+					Legs: 4,
+				},
+				Breed: "Beagle",
+			},
+			Age: 1,
+		}
+		inst, err := env.Insert("", data, EmbedAsSuperclass)
+		assert.NilError(t, err)
+
+		var out Puppy
+		err = inst.Extract(&out)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, out, data)
+	})
+}
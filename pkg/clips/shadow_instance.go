@@ -19,14 +19,32 @@ import "C"
    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 */
 import (
+	"fmt"
 	"reflect"
 )
 
 // Insert inserts the given object as a shadow instance in CLIPS. A shadow class
-// will be created if it does not already exist
+// will be created if it does not already exist. With the BindInstance option,
+// the returned instance remains linked to the given struct
 func (env *Environment) Insert(name string, basis interface{}, opts ...InsertClassOption) (*Instance, error) {
+	bind := false
+	for _, opt := range opts {
+		if opt == BindInstance {
+			if err := checkBindable(basis); err != nil {
+				return nil, err
+			}
+			bind = true
+		}
+	}
 	knownBases := make(map[reflect.Value]InstanceName)
-	return env.insertInstance(name, basis, knownBases)
+	inst, err := env.insertInstance(name, basis, knownBases, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if bind {
+		inst.bind(basis, opts...)
+	}
+	return inst, nil
 }
 
 func (env *Environment) insertInstance(name string, basis interface{}, knownBases map[reflect.Value]InstanceName, opts ...InsertClassOption) (*Instance, error) {
@@ -40,20 +58,22 @@ func (env *Environment) insertInstance(name string, basis interface{}, knownBase
 	if err != nil {
 		return nil, err
 	}
-	cls, err := env.checkRecurseClass(classname, typ)
+	cls, err := env.checkRecurseClass(classname, typ, opts...)
 	if err != nil {
 		return nil, err
 	}
+	plan := env.planFor(typ)
+	if plan.key != nil && name == "" {
+		// the key field doubles as the instance name
+		name = fmt.Sprint(val.FieldByIndex(plan.key).Interface())
+	}
 	inst, err := cls.NewInstance(name, true)
 	if err != nil {
 		return nil, err
 	}
 	knownBases[val] = inst.Name()
-	for ii := 0; ii < typ.NumField(); ii++ {
-		field := typ.Field(ii)
-		fieldval := val.Field(ii)
-
-		if err := inst.fillSlot(field, fieldval, knownBases); err != nil {
+	for ii, fieldplan := range plan.fields {
+		if err := inst.fillSlot(fieldplan, val.Field(ii), knownBases, opts...); err != nil {
 			return nil, err
 		}
 	}
@@ -66,39 +86,68 @@ func (env *Environment) insertInstance(name string, basis interface{}, knownBase
 	return inst, nil
 }
 
-func (inst *Instance) fillSlot(field reflect.StructField, fieldval reflect.Value, knownBases map[reflect.Value]InstanceName) error {
-	if field.Anonymous {
-		for ii := 0; ii < field.Type.NumField(); ii++ {
-			subfield := field.Type.Field(ii)
-			subval := fieldval.Field(ii)
-			if err := inst.fillSlot(subfield, subval, knownBases); err != nil {
+func (inst *Instance) fillSlot(plan fieldPlan, fieldval reflect.Value, knownBases map[reflect.Value]InstanceName, opts ...InsertClassOption) error {
+	if plan.embedded != nil {
+		if fieldval.Kind() == reflect.Ptr {
+			if fieldval.IsNil() {
+				return nil
+			}
+			fieldval = fieldval.Elem()
+		}
+		for ii, subplan := range inst.env.planFor(plan.embedded).fields {
+			if err := inst.fillSlot(subplan, fieldval.Field(ii), knownBases, opts...); err != nil {
 				return err
 			}
 		}
 		return nil
 	}
 
+	field := plan.field
+	tag := plan.tag
+	if tag.omit {
+		return nil
+	}
+	if tag.hasDefault && fieldval.Kind() == reflect.Ptr && fieldval.IsNil() {
+		defval, err := tag.defaultValue(inst.env, field.Type)
+		if err != nil {
+			return err
+		}
+		return inst.SetSlot(tag.name, defval)
+	}
+	if plan.converted {
+		// converted when the slot is set
+		return inst.SetSlot(tag.name, fieldval.Interface())
+	}
 	fieldtype := field.Type
 	fielddata := fieldval
 	if fieldtype.Kind() == reflect.Ptr {
+		fieldtype = fieldtype.Elem()
 		if fieldval.IsNil() {
-			return inst.SetSlot(slotNameFor(field), InstanceName("nil"))
+			switch fieldtype.Kind() {
+			case reflect.Struct:
+				return inst.SetSlot(tag.name, InstanceName("nil"))
+			case reflect.Array, reflect.Slice:
+				return inst.SetSlot(tag.name, []interface{}{})
+			}
+			return inst.SetSlot(tag.name, inst.env.nilSymbol)
 		}
-		fieldtype = fieldtype.Elem()
 		fielddata = fielddata.Elem()
 	}
 
 	if fieldtype.Kind() != reflect.Struct {
-		return inst.SetSlot(slotNameFor(field), fielddata.Interface())
+		if err := tag.check(fielddata.Interface()); err != nil {
+			return err
+		}
+		return inst.SetSlot(tag.name, tag.convert(fielddata.Interface()))
 	}
 	// may need to recurse
 	subinstName, ok := knownBases[fielddata]
 	if ok {
-		return inst.SetSlot(slotNameFor(field), subinstName)
+		return inst.SetSlot(tag.name, subinstName)
 	}
-	subinst, err := inst.env.insertInstance("", fieldval.Interface(), knownBases)
+	subinst, err := inst.env.insertInstance("", fieldval.Interface(), knownBases, opts...)
 	if err != nil {
 		return err
 	}
-	return inst.SetSlot(slotNameFor(field), subinst.Name())
+	return inst.SetSlot(tag.name, subinst.Name())
 }
@@ -0,0 +1,378 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// FlattenNestedStructs makes InsertTemplate and AssertStruct store the fields of nested structs in
+// the parent template, as slots named "Field.Subfield", rather than as separate facts referred to
+// by FACT-ADDRESS
+const FlattenNestedStructs InsertClassOption = "FlattenNestedStructs"
+
+// InsertTemplate creates a representation of a Go struct as a CLIPS deftemplate. Slot names are
+// determined by the same rules as for InsertClass. Unless the FlattenNestedStructs option is given,
+// nested structs become slots of type FACT-ADDRESS, and a template is also inserted for them
+func (env *Environment) InsertTemplate(basis interface{}, opts ...InsertClassOption) (*Template, error) {
+	typ := reflect.TypeOf(basis)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	tplname, err := classNameFor(typ)
+	if err != nil {
+		return nil, err
+	}
+	tpl, err := env.FindTemplate(tplname)
+	if err == nil {
+		return tpl, fmt.Errorf("Template %s already exists", tplname)
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf(`Unable to insert deftemplate for type "%s"`, typ.String())
+	}
+	if err := env.insertShadowTemplate(tplname, typ, opts...); err != nil {
+		return nil, err
+	}
+	return env.FindTemplate(tplname)
+}
+
+func hasOption(opts []InsertClassOption, opt InsertClassOption) bool {
+	for _, v := range opts {
+		if v == opt {
+			return true
+		}
+	}
+	return false
+}
+
+func (env *Environment) insertShadowTemplate(tplname string, typ reflect.Type, opts ...InsertClassOption) error {
+	var deftemplate strings.Builder
+	// templates refer to each other by FACT-ADDRESS, which is not restricted to a template, so
+	// nested templates can be inserted once this one exists
+	nested := make([]reflect.Type, 0)
+	flattening := make(map[reflect.Type]bool)
+	flattening[typ] = true
+
+	fmt.Fprintf(&deftemplate, "(deftemplate %s\n", tplname)
+	for ii := 0; ii < typ.NumField(); ii++ {
+		if err := env.deftemplateSlots(&deftemplate, typ.Field(ii), "", &nested, flattening, opts...); err != nil {
+			return err
+		}
+	}
+	fmt.Fprint(&deftemplate, ")")
+	if err := env.Build(deftemplate.String()); err != nil {
+		return err
+	}
+
+	for _, subtype := range nested {
+		if _, err := env.checkRecurseTemplate(subtype, opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (env *Environment) deftemplateSlots(deftemplate *strings.Builder, field reflect.StructField, prefix string, nested *[]reflect.Type, flattening map[reflect.Type]bool, opts ...InsertClassOption) error {
+	if embedded, ok := embeddedStruct(field); ok {
+		// treat fields of the anonymous struct just like they are native
+		for ii := 0; ii < embedded.NumField(); ii++ {
+			if err := env.deftemplateSlots(deftemplate, embedded.Field(ii), prefix, nested, flattening, opts...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	tag := slotTagFor(field)
+	if tag.omit {
+		return nil
+	}
+	slotname := prefix + tag.name
+	if conv, ok := env.fieldConverter(field.Type); ok {
+		fmt.Fprintf(deftemplate, "    (slot %s%s)\n", slotname, tag.slotFacets(tag.convertedType(conv), field.Type.Kind() == reflect.Ptr, env.nilSymbol))
+		return nil
+	}
+	fieldtype := field.Type
+	isPtr := false
+	if fieldtype.Kind() == reflect.Ptr {
+		fieldtype = fieldtype.Elem()
+		isPtr = true
+	}
+	switch fieldtype.Kind() {
+	case reflect.Interface:
+		fmt.Fprintf(deftemplate, "    (slot %s (type ?VARIABLE)%s)\n", slotname, tag.facets(""))
+		return nil
+	case reflect.Struct:
+		if hasOption(opts, FlattenNestedStructs) {
+			if flattening[fieldtype] {
+				return fmt.Errorf(`Unable to flatten recursive type for field "%s"`, field.Name)
+			}
+			flattening[fieldtype] = true
+			defer delete(flattening, fieldtype)
+			for ii := 0; ii < fieldtype.NumField(); ii++ {
+				if err := env.deftemplateSlots(deftemplate, fieldtype.Field(ii), slotname+".", nested, flattening, opts...); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if _, err := classNameFor(fieldtype); err != nil {
+			return err
+		}
+		*nested = append(*nested, fieldtype)
+		if isPtr {
+			fmt.Fprintf(deftemplate, "    (slot %s (type FACT-ADDRESS SYMBOL) (allowed-symbols %s) (default %s))\n", slotname, env.nilSymbol, env.nilSymbol)
+		} else {
+			fmt.Fprintf(deftemplate, "    (slot %s (type FACT-ADDRESS))\n", slotname)
+		}
+		return nil
+	case reflect.Map:
+		// facts hold maps as multifields in either map mode; only instance slots own entries
+		if fieldtype.Key().Kind() != reflect.String {
+			return fmt.Errorf(`Unable to represent type for field "%s": Key type must be type string`, field.Name)
+		}
+		fmt.Fprintf(deftemplate, "    (multislot %s)\n", slotname)
+		return nil
+	case reflect.Array, reflect.Slice:
+		// don't handle here
+	default:
+		clipsType := env.overflowType(fieldtype, tag.slotType(fieldtype))
+		fmt.Fprintf(deftemplate, "    (slot %s%s)\n", slotname, tag.slotFacets(clipsType, isPtr, env.nilSymbol))
+		return nil
+	}
+
+	subtype := fieldtype.Elem()
+	if subtype.Kind() == reflect.Ptr {
+		subtype = subtype.Elem()
+	}
+	var clipsSubtype string
+	if conv, ok := env.fieldConverter(fieldtype.Elem()); ok {
+		clipsSubtype = tag.convertedType(conv)
+		fmt.Fprintf(deftemplate, "    (multislot %s (type %s)%s)\n", slotname, clipsSubtype, tag.facets(clipsSubtype))
+		return nil
+	}
+	switch subtype.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map:
+		return fmt.Errorf(`Unable to represent type for field "%s"`, field.Name)
+	case reflect.Interface:
+		clipsSubtype = "?VARIABLE"
+	case reflect.Struct:
+		if _, err := classNameFor(subtype); err != nil {
+			return err
+		}
+		*nested = append(*nested, subtype)
+		clipsSubtype = "FACT-ADDRESS"
+	default:
+		clipsSubtype = env.overflowType(subtype, tag.slotType(subtype))
+	}
+	fmt.Fprintf(deftemplate, "    (multislot %s (type %s)%s)\n", slotname, clipsSubtype, tag.facets(clipsSubtype))
+	return nil
+}
+
+func (env *Environment) checkRecurseTemplate(typ reflect.Type, opts ...InsertClassOption) (*Template, error) {
+	if env.batch != nil {
+		if tpl, ok := env.batch.templates[typ]; ok {
+			return tpl, nil
+		}
+	}
+	tplname, err := classNameFor(typ)
+	if err != nil {
+		return nil, err
+	}
+	tpl, err := env.FindTemplate(tplname)
+	if err != nil {
+		if tpl, err = env.InsertTemplate(reflect.Zero(reflect.PtrTo(typ)).Interface(), opts...); err != nil {
+			return nil, err
+		}
+	}
+	if env.batch != nil {
+		env.batch.templates[typ] = tpl
+	}
+	return tpl, nil
+}
+
+// AssertStruct asserts the given struct as a template fact. The template is inserted as by
+// InsertTemplate if it does not already exist; the same options should be given each time. Nested
+// structs are asserted as facts of their own unless FlattenNestedStructs is given, and are
+// retracted again if the struct itself can't be asserted
+func (env *Environment) AssertStruct(v interface{}, opts ...InsertClassOption) (Fact, error) {
+	knownFacts := make(map[reflect.Value]Fact)
+	fact, err := env.assertStruct(reflect.ValueOf(v), knownFacts, make(map[reflect.Value]bool), opts...)
+	if err != nil {
+		retractNested(knownFacts)
+		return nil, err
+	}
+	return fact, nil
+}
+
+// retractNested retracts and drops the facts asserted for the nested structs of a struct that
+// could not be asserted, so that nothing is left half made
+func retractNested(knownFacts map[reflect.Value]Fact) {
+	for _, fact := range knownFacts {
+		if fact.Asserted() {
+			fact.Retract()
+		}
+		fact.Drop()
+	}
+}
+
+func (env *Environment) assertStruct(val reflect.Value, knownFacts map[reflect.Value]Fact, asserting map[reflect.Value]bool, opts ...InsertClassOption) (Fact, error) {
+	if val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil, fmt.Errorf("Unable to assert nil value")
+		}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return nil, fmt.Errorf(`Unable to assert fact for type "%s"`, val.Type().String())
+	}
+	if fact, ok := knownFacts[val]; ok {
+		return fact, nil
+	}
+	if asserting[val] {
+		// a fact must be asserted before it can be referred to, so a cycle can't be represented
+		return nil, fmt.Errorf(`Unable to assert recursive reference to "%s"`, val.Type().String())
+	}
+	asserting[val] = true
+	defer delete(asserting, val)
+
+	tpl, err := env.checkRecurseTemplate(val.Type(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	slots, err := env.structSlotValues(val, knownFacts, asserting, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	fact, err := tpl.NewFact()
+	if err != nil {
+		return nil, err
+	}
+	tfact := fact.(*TemplateFact)
+	for name, slotval := range slots {
+		if err := tfact.Set(name, slotval); err != nil {
+			return nil, err
+		}
+	}
+	if err := tfact.Assert(); err != nil {
+		return nil, err
+	}
+	knownFacts[val] = tfact
+	return tfact, nil
+}
+
+// structSlotValues returns the slot values of a fact for the given struct, by slot name
+func (env *Environment) structSlotValues(val reflect.Value, knownFacts map[reflect.Value]Fact, asserting map[reflect.Value]bool, opts ...InsertClassOption) (map[string]interface{}, error) {
+	slots := make(map[string]interface{})
+	for ii, plan := range env.planFor(val.Type()).fields {
+		if err := env.factSlotValues(slots, plan, val.Field(ii), "", knownFacts, asserting, opts...); err != nil {
+			return nil, err
+		}
+	}
+	return slots, nil
+}
+
+func (env *Environment) factSlotValues(slots map[string]interface{}, plan fieldPlan, fieldval reflect.Value, prefix string, knownFacts map[reflect.Value]Fact, asserting map[reflect.Value]bool, opts ...InsertClassOption) error {
+	if plan.embedded != nil {
+		if fieldval.Kind() == reflect.Ptr {
+			if fieldval.IsNil() {
+				return nil
+			}
+			fieldval = fieldval.Elem()
+		}
+		for ii, subplan := range env.planFor(plan.embedded).fields {
+			if err := env.factSlotValues(slots, subplan, fieldval.Field(ii), prefix, knownFacts, asserting, opts...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	tag := plan.tag
+	if tag.omit {
+		return nil
+	}
+	slotname := prefix + tag.name
+	if tag.hasDefault && fieldval.Kind() == reflect.Ptr && fieldval.IsNil() {
+		// left for the template default; a zero value is kept, as it may have been meant
+		return nil
+	}
+	if plan.converted {
+		// converted when the slot is set
+		slots[slotname] = fieldval.Interface()
+		return nil
+	}
+	fieldtype := plan.field.Type
+	fielddata := fieldval
+	if fieldtype.Kind() == reflect.Ptr {
+		fieldtype = fieldtype.Elem()
+		if fieldval.IsNil() {
+			if fieldtype.Kind() == reflect.Struct && hasOption(opts, FlattenNestedStructs) {
+				// flattened slots of a nil struct keep their defaults
+				return nil
+			}
+			switch fieldtype.Kind() {
+			case reflect.Array, reflect.Slice:
+				slots[slotname] = []interface{}{}
+			default:
+				slots[slotname] = env.nilSymbol
+			}
+			return nil
+		}
+		fielddata = fieldval.Elem()
+	}
+
+	switch fieldtype.Kind() {
+	case reflect.Struct:
+		if hasOption(opts, FlattenNestedStructs) {
+			for ii, subplan := range env.planFor(fieldtype).fields {
+				if err := env.factSlotValues(slots, subplan, fielddata.Field(ii), slotname+".", knownFacts, asserting, opts...); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		subfact, err := env.assertStruct(fielddata, knownFacts, asserting, opts...)
+		if err != nil {
+			return err
+		}
+		slots[slotname] = subfact
+		return nil
+	case reflect.Array, reflect.Slice:
+		subtype := fieldtype.Elem()
+		if subtype.Kind() == reflect.Ptr {
+			subtype = subtype.Elem()
+		}
+		if subtype.Kind() != reflect.Struct {
+			break
+		}
+		subfacts := make([]interface{}, fielddata.Len())
+		for ii := 0; ii < fielddata.Len(); ii++ {
+			subfact, err := env.assertStruct(fielddata.Index(ii), knownFacts, asserting, opts...)
+			if err != nil {
+				return err
+			}
+			subfacts[ii] = subfact
+		}
+		slots[slotname] = subfacts
+		return nil
+	}
+	if err := tag.check(fielddata.Interface()); err != nil {
+		return err
+	}
+	slots[slotname] = tag.convert(fielddata.Interface())
+	return nil
+}
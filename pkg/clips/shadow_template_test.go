@@ -0,0 +1,279 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+type TemplateAddress struct {
+	Street string
+	Zip    int
+}
+
+type TemplatePerson struct {
+	Name    string `json:"name"`
+	Age     int    `clips:"age"`
+	Tags    []Symbol
+	Home    TemplateAddress
+	Work    *TemplateAddress
+	Friends []*TemplatePerson
+}
+
+func TestInsertTemplate(t *testing.T) {
+	t.Run("Basic insert", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		type TestTemplate struct {
+			Intval   int `json:"name"`
+			Floatval float64
+			IntSlice []int
+			SymSlice *[]Symbol
+			GenVal   interface{}
+		}
+		var template *TestTemplate
+
+		tpl, err := env.InsertTemplate(template)
+		assert.NilError(t, err)
+		assert.Equal(t, tpl.Name(), "TestTemplate")
+
+		slots := tpl.Slots()
+		assert.Equal(t, len(slots), 5)
+		assert.DeepEqual(t, slots["_name"].Types(), []Symbol{"INTEGER"})
+		assert.Assert(t, !slots["_name"].Multifield())
+		assert.DeepEqual(t, slots["Floatval"].Types(), []Symbol{"FLOAT"})
+		assert.DeepEqual(t, slots["IntSlice"].Types(), []Symbol{"INTEGER"})
+		assert.Assert(t, slots["IntSlice"].Multifield())
+		assert.DeepEqual(t, slots["SymSlice"].Types(), []Symbol{"SYMBOL"})
+		assert.Assert(t, slots["SymSlice"].Multifield())
+
+		_, err = env.InsertTemplate(template)
+		assert.ErrorContains(t, err, "already exists")
+	})
+
+	t.Run("Nested insert", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		tpl, err := env.InsertTemplate((*TemplatePerson)(nil))
+		assert.NilError(t, err)
+
+		slots := tpl.Slots()
+		assert.DeepEqual(t, slots["Home"].Types(), []Symbol{"FACT-ADDRESS"})
+		assert.DeepEqual(t, slots["Work"].Types(), []Symbol{"FACT-ADDRESS", "SYMBOL"})
+		assert.DeepEqual(t, slots["Friends"].Types(), []Symbol{"FACT-ADDRESS"})
+		assert.Assert(t, slots["Friends"].Multifield())
+
+		_, err = env.FindTemplate("TemplateAddress")
+		assert.NilError(t, err)
+	})
+
+	t.Run("Flattened insert", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		type Flat struct {
+			Name string
+			Home TemplateAddress
+			Work *TemplateAddress
+		}
+		tpl, err := env.InsertTemplate((*Flat)(nil), FlattenNestedStructs)
+		assert.NilError(t, err)
+
+		slots := tpl.Slots()
+		assert.Equal(t, len(slots), 5)
+		assert.DeepEqual(t, slots["Home.Zip"].Types(), []Symbol{"INTEGER"})
+		assert.DeepEqual(t, slots["Work.Street"].Types(), []Symbol{"STRING"})
+
+		_, err = env.FindTemplate("TemplateAddress")
+		assert.ErrorContains(t, err, "not found")
+	})
+
+	t.Run("Flattened recursive insert", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := env.InsertTemplate((*ComposeParentClass)(nil), FlattenNestedStructs)
+		assert.ErrorContains(t, err, "recursive")
+	})
+
+	t.Run("Insert non-struct", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := env.InsertTemplate(Symbol("foo"))
+		assert.ErrorContains(t, err, "Unable to insert deftemplate")
+	})
+}
+
+func TestAssertStruct(t *testing.T) {
+	t.Run("Basic assert", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		type Point struct {
+			X    int
+			Y    int
+			Tags []Symbol
+		}
+		fact, err := env.AssertStruct(Point{
+			X:    3,
+			Y:    4,
+			Tags: []Symbol{"a", "b"},
+		})
+		assert.NilError(t, err)
+		assert.Assert(t, fact.Asserted())
+		assert.Equal(t, fact.String(), "(Point (X 3) (Y 4) (Tags a b))")
+
+		var out Point
+		err = fact.Extract(&out)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, out, Point{
+			X:    3,
+			Y:    4,
+			Tags: []Symbol{"a", "b"},
+		})
+	})
+
+	t.Run("Nested assert", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		friend := &TemplatePerson{
+			Name: "Alice",
+			Age:  40,
+			Home: TemplateAddress{
+				Street: "Elm",
+				Zip:    12345,
+			},
+		}
+		person := &TemplatePerson{
+			Name: "Bob",
+			Age:  42,
+			Home: TemplateAddress{
+				Street: "Main",
+				Zip:    54321,
+			},
+			Work:    &friend.Home,
+			Friends: []*TemplatePerson{friend},
+		}
+		fact, err := env.AssertStruct(person)
+		assert.NilError(t, err)
+
+		// Bob's work address is Alice's home, so it is only asserted once
+		assert.Equal(t, len(env.Facts()), 4)
+
+		home, err := fact.Slot("Home")
+		assert.NilError(t, err)
+		assert.Equal(t, home.(Fact).String(), `(TemplateAddress (Street "Main") (Zip 54321))`)
+
+		var out TemplatePerson
+		err = fact.Extract(&out)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, out, *person)
+	})
+
+	t.Run("Nil nested struct", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		fact, err := env.AssertStruct(TemplatePerson{
+			Name: "Carol",
+		})
+		assert.NilError(t, err)
+
+		work, err := fact.Slot("Work")
+		assert.NilError(t, err)
+		assert.Equal(t, work, nil)
+
+		var out TemplatePerson
+		err = fact.Extract(&out)
+		assert.NilError(t, err)
+		assert.Assert(t, out.Work == nil)
+	})
+
+	t.Run("Flattened assert", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		type Flat struct {
+			Name string
+			Home TemplateAddress
+		}
+		data := Flat{
+			Name: "Dave",
+			Home: TemplateAddress{
+				Street: "High",
+				Zip:    11111,
+			},
+		}
+		fact, err := env.AssertStruct(data, FlattenNestedStructs)
+		assert.NilError(t, err)
+		assert.Equal(t, fact.String(), `(Flat (Name "Dave") (Home.Street "High") (Home.Zip 11111))`)
+
+		var out Flat
+		err = fact.Extract(&out)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, out, data)
+	})
+
+	t.Run("Nested facts retracted on failure", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		type Gauge struct {
+			Home  TemplateAddress
+			Level int `clips:",range=0..10"`
+		}
+		count := len(env.Facts())
+		_, err := env.AssertStruct(Gauge{
+			Home:  TemplateAddress{Street: "Elm", Zip: 12345},
+			Level: 11,
+		})
+		assert.ErrorContains(t, err, "above the range")
+		assert.Equal(t, len(env.Facts()), count)
+
+		type Visitor struct {
+			Name  string
+			Home  TemplateAddress
+			Extra int
+		}
+		tpl, err := env.InsertTemplate((*TemplatePerson)(nil))
+		assert.NilError(t, err)
+		count = len(env.Facts())
+		_, err = tpl.AssertStruct(Visitor{
+			Name:  "Frank",
+			Home:  TemplateAddress{Street: "Oak", Zip: 22222},
+			Extra: 1,
+		})
+		assert.ErrorContains(t, err, `has no slot "Extra"`)
+		assert.Equal(t, len(env.Facts()), count)
+	})
+
+	t.Run("Recursive assert", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		person := &TemplatePerson{
+			Name: "Eve",
+		}
+		person.Friends = []*TemplatePerson{person}
+		_, err := env.AssertStruct(person)
+		assert.ErrorContains(t, err, "recursive reference")
+	})
+}
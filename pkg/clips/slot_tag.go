@@ -0,0 +1,311 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// slotTag holds the options given in the "clips" tag of a struct field, e.g.
+// `clips:"name,symbol,allowed=a|b|c"`
+type slotTag struct {
+	name       string
+	typ        Type
+	hasType    bool
+	omit       bool
+	key        bool
+	defaultVal string
+	hasDefault bool
+	allowed    []string
+	rangeLow   string
+	rangeHigh  string
+	hasRange   bool
+}
+
+var slotTagTypes = map[string]Type{
+	"symbol":        SYMBOL,
+	"string":        STRING,
+	"integer":       INTEGER,
+	"float":         FLOAT,
+	"instance-name": INSTANCE_NAME,
+}
+
+func slotTagFor(field reflect.StructField) slotTag {
+	ret := slotTag{
+		name: field.Name,
+	}
+	if tag, ok := field.Tag.Lookup("json"); ok {
+		if name := strings.Split(tag, ",")[0]; name != "" {
+			ret.name = name
+		}
+	}
+	if ret.name == "name" {
+		ret.name = "_name"
+	}
+	tag, ok := field.Tag.Lookup("clips")
+	if !ok {
+		return ret
+	}
+	opts := strings.Split(tag, ",")
+	if opts[0] != "" {
+		ret.name = opts[0]
+	}
+	for _, opt := range opts[1:] {
+		switch {
+		case opt == "omit":
+			ret.omit = true
+		case opt == "key":
+			ret.key = true
+		case strings.HasPrefix(opt, "default="):
+			ret.defaultVal = strings.TrimPrefix(opt, "default=")
+			ret.hasDefault = true
+		case strings.HasPrefix(opt, "allowed="):
+			ret.allowed = strings.Split(strings.TrimPrefix(opt, "allowed="), "|")
+		case strings.HasPrefix(opt, "range="):
+			bounds := strings.SplitN(strings.TrimPrefix(opt, "range="), "..", 2)
+			ret.rangeLow = bounds[0]
+			if len(bounds) > 1 {
+				ret.rangeHigh = bounds[1]
+			}
+			ret.hasRange = true
+		default:
+			if typ, ok := slotTagTypes[strings.ToLower(opt)]; ok {
+				ret.typ = typ
+				ret.hasType = true
+			}
+		}
+	}
+	return ret
+}
+
+// slotType returns the CLIPS type for the slot, which may be forced by the tag
+func (tag slotTag) slotType(typ reflect.Type) string {
+	if tag.hasType {
+		return tag.typ.String()
+	}
+	return clipsTypeFor(typ).String()
+}
+
+// convertedType returns the CLIPS type for a slot holding values of a converted type
+func (tag slotTag) convertedType(conv *Converter) string {
+	if tag.hasType {
+		return tag.typ.String()
+	}
+	return conv.ClipsType.String()
+}
+
+// overflowType widens the slot type of an unsigned field, which may hold values too large for an
+// INTEGER, to include the fallback type of the overflow policy
+func (env *Environment) overflowType(typ reflect.Type, clipsType string) string {
+	if clipsType != INTEGER.String() {
+		return clipsType
+	}
+	switch typ.Kind() {
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+	default:
+		return clipsType
+	}
+	switch env.overflow {
+	case OVERFLOW_FLOAT:
+		return clipsType + " " + FLOAT.String()
+	case OVERFLOW_STRING:
+		return clipsType + " " + STRING.String()
+	}
+	return clipsType
+}
+
+// literal formats a value given in the tag as a CLIPS constant for a slot of the given type
+func (tag slotTag) literal(clipsType string, value string) string {
+	if clipsType == STRING.String() && !strings.HasPrefix(value, `"`) {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// slotFacets returns the type and other attributes of a single-field slot. An optional slot, for a
+// pointer field, may also hold the nil symbol
+func (tag slotTag) slotFacets(clipsType string, optional bool, nilSymbol Symbol) string {
+	if !optional {
+		return fmt.Sprintf(" (type %s)%s", clipsType, tag.facets(clipsType))
+	}
+	if clipsType == SYMBOL.String() {
+		if len(tag.allowed) > 0 {
+			return fmt.Sprintf(" (type %s)%s", clipsType, tag.facets(clipsType, string(nilSymbol)))
+		}
+		return fmt.Sprintf(" (type %s)%s", clipsType, tag.facets(clipsType))
+	}
+	ret := fmt.Sprintf(" (type %s SYMBOL)", clipsType)
+	if len(tag.allowed) > 0 {
+		// allowed-symbols can't be combined with allowed-values
+		ret += tag.facets(clipsType, string(nilSymbol))
+	} else {
+		ret += fmt.Sprintf(" (allowed-symbols %s)", nilSymbol) + tag.facets(clipsType)
+	}
+	if !tag.hasDefault {
+		ret += fmt.Sprintf(" (default %s)", nilSymbol)
+	}
+	return ret
+}
+
+// facets returns the slot attributes corresponding to the tag options
+func (tag slotTag) facets(clipsType string, extraAllowed ...string) string {
+	var ret strings.Builder
+	if len(tag.allowed) > 0 {
+		ret.WriteString(" (allowed-values")
+		for _, v := range tag.allowed {
+			fmt.Fprintf(&ret, " %s", tag.literal(clipsType, v))
+		}
+		for _, v := range extraAllowed {
+			fmt.Fprintf(&ret, " %s", v)
+		}
+		ret.WriteString(")")
+	}
+	if tag.hasRange {
+		low, high := tag.rangeLow, tag.rangeHigh
+		if low == "" {
+			low = "?VARIABLE"
+		}
+		if high == "" {
+			high = "?VARIABLE"
+		}
+		fmt.Fprintf(&ret, " (range %s %s)", low, high)
+	}
+	if tag.hasDefault {
+		fmt.Fprintf(&ret, " (default %s)", tag.literal(clipsType, tag.defaultVal))
+	}
+	return ret.String()
+}
+
+// defaultValue returns the default given in the tag, as a Go value
+func (tag slotTag) defaultValue(env *Environment, typ reflect.Type) (interface{}, error) {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array:
+		return env.Eval(fmt.Sprintf("(create$ %s)", tag.defaultVal))
+	}
+	return env.Eval(tag.literal(tag.slotType(typ), tag.defaultVal))
+}
+
+// convert changes value to the type forced by the tag, if any
+func (tag slotTag) convert(value interface{}) interface{} {
+	if !tag.hasType || value == nil {
+		return value
+	}
+	val := reflect.ValueOf(value)
+	switch val.Kind() {
+	case reflect.Slice, reflect.Array:
+		ret := make([]interface{}, val.Len())
+		for ii := 0; ii < val.Len(); ii++ {
+			ret[ii] = tag.convert(val.Index(ii).Interface())
+		}
+		return ret
+	case reflect.String:
+		switch tag.typ {
+		case SYMBOL:
+			return Symbol(val.String())
+		case STRING:
+			return val.String()
+		case INSTANCE_NAME:
+			return InstanceName(val.String())
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if tag.typ == FLOAT {
+			return float64(val.Int())
+		}
+	case reflect.Float32, reflect.Float64:
+		if tag.typ == INTEGER {
+			return int64(val.Float())
+		}
+	}
+	return value
+}
+
+// check returns an error if value is not allowed by the tag
+func (tag slotTag) check(value interface{}) error {
+	if value == nil || (len(tag.allowed) == 0 && !tag.hasRange) {
+		return nil
+	}
+	val := reflect.ValueOf(value)
+	switch val.Kind() {
+	case reflect.Slice, reflect.Array:
+		for ii := 0; ii < val.Len(); ii++ {
+			if err := tag.check(val.Index(ii).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Ptr:
+		if val.IsNil() {
+			return nil
+		}
+		return tag.check(val.Elem().Interface())
+	}
+	if len(tag.allowed) > 0 {
+		str := fmt.Sprint(value)
+		found := false
+		for _, v := range tag.allowed {
+			if v == str || strings.Trim(v, `"`) == str {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf(`Value %v of slot "%s" is not one of the allowed values %s`, value, tag.name, strings.Join(tag.allowed, " "))
+		}
+	}
+	if tag.hasRange {
+		var num float64
+		switch val.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			num = float64(val.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			num = float64(val.Uint())
+		case reflect.Float32, reflect.Float64:
+			num = val.Float()
+		default:
+			return nil
+		}
+		if low, err := strconv.ParseFloat(tag.rangeLow, 64); err == nil && num < low {
+			return fmt.Errorf(`Value %v of slot "%s" is below the range %s..%s`, value, tag.name, tag.rangeLow, tag.rangeHigh)
+		}
+		if high, err := strconv.ParseFloat(tag.rangeHigh, 64); err == nil && num > high {
+			return fmt.Errorf(`Value %v of slot "%s" is above the range %s..%s`, value, tag.name, tag.rangeLow, tag.rangeHigh)
+		}
+	}
+	return nil
+}
+
+// keyFieldFor returns the field of typ tagged as the key, if any
+func keyFieldFor(typ reflect.Type) (reflect.StructField, bool) {
+	for ii := 0; ii < typ.NumField(); ii++ {
+		field := typ.Field(ii)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if ret, ok := keyFieldFor(field.Type); ok {
+				ret.Index = append([]int{ii}, ret.Index...)
+				return ret, true
+			}
+			continue
+		}
+		if slotTagFor(field).key {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
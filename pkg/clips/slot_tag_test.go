@@ -0,0 +1,216 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"reflect"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+type TaggedClass struct {
+	ID       string   `clips:"id,key"`
+	Kind     string   `clips:"kind,symbol,allowed=cat|dog"`
+	Level    int      `clips:",range=0..100"`
+	Owner    string   `clips:",default=nobody"`
+	Cache    []string `clips:",omit"`
+	Nickname string   `json:"name,omitempty"`
+}
+
+type OptionalTagged struct {
+	ID    string  `clips:"id,key"`
+	Owner *string `clips:",default=nobody"`
+	Mood  *string `clips:",symbol,allowed=happy|sad"`
+}
+
+func TestSlotTag(t *testing.T) {
+	t.Run("Parse tag", func(t *testing.T) {
+		typ := reflect.TypeOf(TaggedClass{})
+
+		tag := slotTagFor(typ.Field(0))
+		assert.Equal(t, tag.name, "id")
+		assert.Assert(t, tag.key)
+
+		tag = slotTagFor(typ.Field(1))
+		assert.Equal(t, tag.name, "kind")
+		assert.Equal(t, tag.typ, SYMBOL)
+		assert.DeepEqual(t, tag.allowed, []string{"cat", "dog"})
+
+		tag = slotTagFor(typ.Field(2))
+		assert.Equal(t, tag.name, "Level")
+		assert.Assert(t, tag.hasRange)
+		assert.Equal(t, tag.rangeLow, "0")
+		assert.Equal(t, tag.rangeHigh, "100")
+
+		tag = slotTagFor(typ.Field(3))
+		assert.Equal(t, tag.defaultVal, "nobody")
+
+		tag = slotTagFor(typ.Field(4))
+		assert.Assert(t, tag.omit)
+
+		tag = slotTagFor(typ.Field(5))
+		assert.Equal(t, tag.name, "_name")
+	})
+
+	t.Run("Insert class", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		cls, err := env.InsertClass((*TaggedClass)(nil))
+		assert.NilError(t, err)
+		assert.Equal(t, cls.String(), `(defclass MAIN::TaggedClass
+   (is-a USER)
+   (slot id
+      (type STRING))
+   (slot kind
+      (type SYMBOL)
+      (allowed-values cat dog))
+   (slot Level
+      (type INTEGER)
+      (range 0 100))
+   (slot Owner
+      (type STRING)
+      (default "nobody"))
+   (slot _name
+      (type STRING)))`)
+	})
+
+	t.Run("Insert instance", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		inst, err := env.Insert("", TaggedClass{
+			ID:    "rex",
+			Kind:  "dog",
+			Level: 5,
+			Cache: []string{"ignored"},
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, inst.Name(), InstanceName("rex"))
+		// an explicit zero value is kept rather than replaced by the default
+		assert.Equal(t, inst.String(), `[rex] of TaggedClass (id "rex") (kind dog) (Level 5) (Owner "") (_name "")`)
+
+		var out TaggedClass
+		err = inst.Extract(&out)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, out, TaggedClass{
+			ID:    "rex",
+			Kind:  "dog",
+			Level: 5,
+		})
+	})
+
+	t.Run("Constraints on insert", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := env.Insert("", TaggedClass{
+			ID:   "tweety",
+			Kind: "bird",
+		})
+		assert.ErrorContains(t, err, "not one of the allowed values")
+
+		_, err = env.Insert("", TaggedClass{
+			ID:    "rex",
+			Kind:  "dog",
+			Level: 101,
+		})
+		assert.ErrorContains(t, err, "above the range")
+	})
+
+	t.Run("Constraints on extract", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		var out TaggedClass
+		err := env.structuredExtract(&out, map[string]interface{}{
+			"kind":  Symbol("cat"),
+			"Level": int64(-1),
+		}, false, make(map[InstanceName]interface{}))
+		assert.ErrorContains(t, err, "below the range")
+
+		// missing slots take the default
+		out = TaggedClass{}
+		err = env.structuredExtract(&out, map[string]interface{}{
+			"kind": Symbol("cat"),
+		}, false, make(map[InstanceName]interface{}))
+		assert.NilError(t, err)
+		assert.Equal(t, out.Owner, "nobody")
+		assert.Equal(t, out.Kind, "cat")
+	})
+
+	t.Run("Insert template", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		tpl, err := env.InsertTemplate((*TaggedClass)(nil))
+		assert.NilError(t, err)
+
+		slots := tpl.Slots()
+		assert.Equal(t, len(slots), 5)
+		allowed, ok := slots["kind"].AllowedValues()
+		assert.Assert(t, ok)
+		assert.DeepEqual(t, allowed, []interface{}{Symbol("cat"), Symbol("dog")})
+		low, hasLow, high, hasHigh := slots["Level"].IntRange()
+		assert.Assert(t, hasLow && hasHigh)
+		assert.Equal(t, low, int64(0))
+		assert.Equal(t, high, int64(100))
+		assert.Equal(t, slots["Owner"].DefaultValue(), "nobody")
+
+		fact, err := env.AssertStruct(TaggedClass{
+			ID:   "felix",
+			Kind: "cat",
+		})
+		assert.NilError(t, err)
+		owner, err := fact.Slot("Owner")
+		assert.NilError(t, err)
+		assert.Equal(t, owner, "")
+	})
+
+	t.Run("Optional fields", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		cls, err := env.InsertClass((*OptionalTagged)(nil))
+		assert.NilError(t, err)
+		assert.Equal(t, cls.String(), `(defclass MAIN::OptionalTagged
+   (is-a USER)
+   (slot id
+      (type STRING))
+   (slot Owner
+      (type STRING SYMBOL)
+      (allowed-symbols nil)
+      (default "nobody"))
+   (slot Mood
+      (type SYMBOL)
+      (allowed-values happy sad nil)))`)
+
+		// the default is used for a nil pointer, but not for a pointer to a zero value
+		inst, err := env.Insert("", OptionalTagged{ID: "a"})
+		assert.NilError(t, err)
+		assert.Equal(t, inst.String(), `[a] of OptionalTagged (id "a") (Owner "nobody") (Mood nil)`)
+		empty := ""
+		inst, err = env.Insert("", OptionalTagged{ID: "b", Owner: &empty})
+		assert.NilError(t, err)
+		assert.Equal(t, inst.String(), `[b] of OptionalTagged (id "b") (Owner "") (Mood nil)`)
+
+		tplenv := CreateEnvironment()
+		defer tplenv.Delete()
+		fact, err := tplenv.AssertStruct(OptionalTagged{ID: "c"})
+		assert.NilError(t, err)
+		assert.Equal(t, fact.String(), `(OptionalTagged (id "c") (Owner "nobody") (Mood nil))`)
+	})
+}
@@ -0,0 +1,418 @@
+package clips
+
+// #cgo CFLAGS: -I ../../clips_source
+// #cgo LDFLAGS: -L ../../clips_source -l clips -lm
+// #include <clips/clips.h>
+//
+// void *last_fact(void *env);
+// void *previous_fact(void *fact);
+// void streamResetFunction(void *env);
+//
+// void add_stream_functions(void *env)
+// {
+//   EnvAddResetFunction(env, "go-stream", streamResetFunction, 0);
+//   EnvAddClearFunction(env, "go-stream", streamResetFunction, 0);
+// }
+//
+// void remove_stream_functions(void *env)
+// {
+//   EnvRemoveResetFunction(env, "go-stream");
+//   EnvRemoveClearFunction(env, "go-stream");
+// }
+import "C"
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+	"unsafe"
+)
+
+// StreamOptions controls how Stream batches its input and what it emits
+type StreamOptions struct {
+	// BatchSize is the most values asserted or inserted before the agenda is run. Defaults to 100
+	BatchSize int
+
+	// BatchTimeout is how long to wait for a batch to fill once its first value has arrived. If 0,
+	// the batch is run as soon as no more values are waiting
+	BatchTimeout time.Duration
+
+	// Tick runs the agenda this often while no input arrives, so that facts expire and timed rules
+	// fire. If 0, the agenda is only run after each batch
+	Tick time.Duration
+
+	// Insert makes structs instances, as by Insert, rather than facts as by AssertStruct. Strings,
+	// facts and maps are asserted either way, as by AssertAll
+	Insert bool
+
+	// InsertOptions are passed on when asserting or inserting structs
+	InsertOptions []InsertClassOption
+
+	// Templates names the templates whose new facts are emitted as conclusions
+	Templates []string
+
+	// Classes names the classes whose new instances are emitted as conclusions. Instances of
+	// subclasses are not included
+	Classes []string
+
+	// Buffer is the capacity of the conclusions channel. Once it is full the stream stops reading
+	// its input until conclusions are received
+	Buffer int
+
+	// OnError is called with each value that could not be asserted or inserted, which is then
+	// skipped. If nil, the stream stops with the error
+	OnError func(value interface{}, err error)
+}
+
+// Conclusion is a fact or instance emitted by Stream. It holds copies of the values, so it may be
+// used while the stream goes on
+type Conclusion struct {
+	// Name is the name of the template or class
+	Name string
+
+	// Text is the fact or instance as CLIPS prints it
+	Text string
+
+	// Slots holds the slot values. An implied fact has one slot, "", holding a list
+	Slots map[string]interface{}
+}
+
+// Stream is a running event-processing loop started by Environment.Stream
+type Stream struct {
+	env       *Environment
+	ctx       context.Context
+	cancel    context.CancelFunc
+	in        <-chan interface{}
+	opts      StreamOptions
+	out       chan Conclusion
+	done      chan struct{}
+	err       error
+	templates map[string]bool
+	seen      int
+	instances map[string]map[InstanceName]bool
+}
+
+// Stream asserts or inserts the values received on in, in batches, running the agenda after each
+// batch and emitting the new facts and instances of the chosen templates and classes as
+// Conclusions. Only conclusions still present once the agenda has run are emitted. The stream
+// owns the environment until it is done: nothing else may use it until Wait has returned.
+//
+// The stream finishes once in is closed and its last batch has run, or when ctx is cancelled, and
+// then closes the conclusions channel. It must be drained, or the stream blocks. Cancelling ctx
+// halts the agenda if it is running. An environment runs one stream at a time; deleting the
+// environment stops its stream
+func (env *Environment) Stream(ctx context.Context, in <-chan interface{}, opts StreamOptions) (*Stream, error) {
+	if env.stream != nil {
+		select {
+		case <-env.stream.done:
+		default:
+			return nil, fmt.Errorf("Environment already has a running stream")
+		}
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Stream{
+		env:       env,
+		ctx:       ctx,
+		cancel:    cancel,
+		in:        in,
+		opts:      opts,
+		out:       make(chan Conclusion, opts.Buffer),
+		done:      make(chan struct{}),
+		templates: make(map[string]bool, len(opts.Templates)),
+		instances: make(map[string]map[InstanceName]bool, len(opts.Classes)),
+	}
+	for _, name := range opts.Templates {
+		s.templates[name] = true
+	}
+	// only what is made once the stream starts is a conclusion
+	if factptr := C.last_fact(env.env); factptr != nil {
+		s.seen = int(C.EnvFactIndex(env.env, factptr))
+	}
+	for _, name := range opts.Classes {
+		s.instances[name] = s.currentInstances(name)
+	}
+	env.stream = s
+	C.add_stream_functions(env.env)
+	go s.loop()
+	return s, nil
+}
+
+// Conclusions returns the channel the conclusions are emitted on
+func (s *Stream) Conclusions() <-chan Conclusion {
+	return s.out
+}
+
+// Wait waits for the stream to finish, returning nil once the input is done, the error from the
+// context if it was cancelled, or the error that stopped the stream
+func (s *Stream) Wait() error {
+	<-s.done
+	return s.err
+}
+
+func (s *Stream) loop() {
+	defer close(s.done)
+	defer close(s.out)
+	defer s.cancel()
+	defer C.remove_stream_functions(s.env.env)
+	var tick <-chan time.Time
+	if s.opts.Tick > 0 {
+		ticker := time.NewTicker(s.opts.Tick)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		var batch []interface{}
+		select {
+		case <-s.ctx.Done():
+			s.err = s.ctx.Err()
+			return
+		case <-tick:
+		case value, ok := <-s.in:
+			if !ok {
+				return
+			}
+			batch = append(batch, value)
+		}
+		closed := false
+		if len(batch) > 0 {
+			batch, closed = s.fill(batch)
+		}
+		if err := s.process(batch); err != nil {
+			s.err = err
+			return
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+// fill adds waiting values to the batch, up to the batch size, returning true if in was closed
+func (s *Stream) fill(batch []interface{}) ([]interface{}, bool) {
+	var timeout <-chan time.Time
+	if s.opts.BatchTimeout > 0 {
+		timer := time.NewTimer(s.opts.BatchTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for len(batch) < s.opts.BatchSize {
+		if timeout == nil {
+			select {
+			case value, ok := <-s.in:
+				if !ok {
+					return batch, true
+				}
+				batch = append(batch, value)
+				continue
+			default:
+				return batch, false
+			}
+		}
+		select {
+		case <-s.ctx.Done():
+			return batch, false
+		case <-timeout:
+			return batch, false
+		case value, ok := <-s.in:
+			if !ok {
+				return batch, true
+			}
+			batch = append(batch, value)
+		}
+	}
+	return batch, false
+}
+
+// process loads the batch, runs the agenda and emits the conclusions
+func (s *Stream) process(batch []interface{}) error {
+	if err := s.load(batch); err != nil {
+		return err
+	}
+	running := make(chan struct{})
+	stopped := make(chan struct{})
+	go s.haltOnCancel(running, stopped)
+	s.env.Run(-1)
+	close(running)
+	<-stopped
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	conclusions, err := s.conclusions()
+	if err != nil {
+		return err
+	}
+	for _, conclusion := range conclusions {
+		select {
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		case s.out <- conclusion:
+		}
+	}
+	return nil
+}
+
+// haltOnCancel halts the agenda if ctx is cancelled before running is closed, closing stopped
+// once it no longer touches the environment. Starting a run clears the halt, so it is repeated
+// until the run is over
+func (s *Stream) haltOnCancel(running <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+	select {
+	case <-running:
+		return
+	case <-s.ctx.Done():
+	}
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		C.EnvSetHaltRules(s.env.env, 1)
+		select {
+		case <-running:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Stream) load(batch []interface{}) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	env := s.env
+	if s.opts.Insert && hasOption(s.opts.InsertOptions, DeferPatternMatching) {
+		delay := C.EnvGetDelayObjectPatternMatching(env.env)
+		C.EnvSetDelayObjectPatternMatching(env.env, 1)
+		defer C.EnvSetDelayObjectPatternMatching(env.env, delay)
+	}
+	defer env.startBatch()()
+	for _, value := range batch {
+		err := s.loadValue(value)
+		if err == nil {
+			continue
+		}
+		if s.opts.OnError == nil {
+			return fmt.Errorf("Unable to load %v: %v", value, err)
+		}
+		s.opts.OnError(value, err)
+	}
+	return nil
+}
+
+func (s *Stream) loadValue(value interface{}) error {
+	switch value.(type) {
+	case nil:
+		return fmt.Errorf("nil value")
+	case string, Fact, map[string]interface{}:
+		return s.env.assertElement(value, s.opts.InsertOptions...)
+	}
+	if !s.opts.Insert {
+		return s.env.assertElement(value, s.opts.InsertOptions...)
+	}
+	inst, err := s.env.insertInstance("", value, make(map[reflect.Value]InstanceName), s.opts.InsertOptions...)
+	if err != nil {
+		return err
+	}
+	inst.Drop()
+	return nil
+}
+
+// conclusions returns the facts of the chosen templates asserted since the last batch, in order,
+// followed by the new instances of the chosen classes
+func (s *Stream) conclusions() ([]Conclusion, error) {
+	env := s.env
+	var ret []Conclusion
+	if len(s.templates) > 0 {
+		var factptrs []unsafe.Pointer
+		last := s.seen
+		for factptr := C.last_fact(env.env); factptr != nil; factptr = C.previous_fact(factptr) {
+			index := int(C.EnvFactIndex(env.env, factptr))
+			if index <= s.seen {
+				break
+			}
+			if index > last {
+				last = index
+			}
+			tplname := C.GoString(C.EnvGetDeftemplateName(env.env, C.EnvFactDeftemplate(env.env, factptr)))
+			if s.templates[tplname] {
+				factptrs = append(factptrs, factptr)
+			}
+		}
+		s.seen = last
+		for ii := len(factptrs) - 1; ii >= 0; ii-- {
+			fact := env.newFact(factptrs[ii])
+			slots, err := fact.Slots()
+			if err != nil {
+				fact.Drop()
+				return nil, err
+			}
+			ret = append(ret, Conclusion{
+				Name:  fact.Template().Name(),
+				Text:  fact.String(),
+				Slots: slots,
+			})
+			fact.Drop()
+		}
+	} else if factptr := C.last_fact(env.env); factptr != nil {
+		s.seen = int(C.EnvFactIndex(env.env, factptr))
+	}
+	for _, name := range s.opts.Classes {
+		cls, err := env.FindClass(name)
+		if err != nil {
+			return nil, err
+		}
+		current := make(map[InstanceName]bool)
+		for _, inst := range cls.Instances() {
+			current[inst.Name()] = true
+			if !s.instances[name][inst.Name()] {
+				ret = append(ret, Conclusion{
+					Name:  name,
+					Text:  inst.String(),
+					Slots: inst.Slots(true),
+				})
+			}
+			inst.Drop()
+		}
+		s.instances[name] = current
+	}
+	return ret, nil
+}
+
+// reset forgets the facts and instances seen, as a reset or clear removes them and restarts the
+// fact numbering
+func (s *Stream) reset() {
+	s.seen = 0
+	for name := range s.instances {
+		s.instances[name] = make(map[InstanceName]bool)
+	}
+}
+
+// currentInstances returns the names of the instances of the named class, if it exists yet
+func (s *Stream) currentInstances(classname string) map[InstanceName]bool {
+	ret := make(map[InstanceName]bool)
+	cls, err := s.env.FindClass(classname)
+	if err != nil {
+		return ret
+	}
+	for _, inst := range cls.Instances() {
+		ret[inst.Name()] = true
+		inst.Drop()
+	}
+	return ret
+}
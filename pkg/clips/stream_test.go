@@ -0,0 +1,217 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+type StreamReading struct {
+	Sensor string
+	Value  float64
+}
+
+func TestStream(t *testing.T) {
+	t.Run("Facts", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := env.InsertTemplate(StreamReading{})
+		assert.NilError(t, err)
+		err = env.Build(`(deftemplate alarm (slot sensor))`)
+		assert.NilError(t, err)
+		err = env.Build(`(defrule too-hot
+			(StreamReading (Sensor ?s) (Value ?v&:(> ?v 100.0)))
+			=>
+			(assert (alarm (sensor ?s))))`)
+		assert.NilError(t, err)
+		_, err = env.AssertString(`(alarm (sensor old))`)
+		assert.NilError(t, err)
+
+		in := make(chan interface{})
+		stream, err := env.Stream(context.Background(), in, StreamOptions{
+			BatchSize: 2,
+			Templates: []string{"alarm"},
+		})
+		assert.NilError(t, err)
+		go func() {
+			in <- StreamReading{Sensor: "a", Value: 20}
+			in <- &StreamReading{Sensor: "b", Value: 120}
+			in <- `(StreamReading (Sensor "c") (Value 150.0))`
+			close(in)
+		}()
+
+		var alarms []Conclusion
+		for conclusion := range stream.Conclusions() {
+			alarms = append(alarms, conclusion)
+		}
+		assert.NilError(t, stream.Wait())
+		assert.Equal(t, len(alarms), 2)
+		assert.Equal(t, alarms[0].Name, "alarm")
+		assert.DeepEqual(t, alarms[0].Slots, map[string]interface{}{"sensor": "b"})
+		assert.Equal(t, alarms[1].Text, `(alarm (sensor "c"))`)
+	})
+
+	t.Run("Reset by a rule", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(deftemplate alarm (slot sensor))`)
+		assert.NilError(t, err)
+		err = env.Build(`(defrule hot (reading ?x&:(> ?x 10)) => (assert (alarm (sensor ?x))))`)
+		assert.NilError(t, err)
+		// after the reset, the new alarm is numbered below the facts already seen, and the last
+		// fact above them
+		err = env.Build(`(defrule restart (restart)
+			=>
+			(reset)
+			(assert (alarm (sensor restarted)))
+			(assert (reading 1) (reading 2) (reading 3)))`)
+		assert.NilError(t, err)
+
+		in := make(chan interface{})
+		stream, err := env.Stream(context.Background(), in, StreamOptions{
+			BatchSize: 1,
+			Templates: []string{"alarm"},
+		})
+		assert.NilError(t, err)
+		go func() {
+			in <- `(reading 20)`
+			in <- `(restart)`
+			close(in)
+		}()
+
+		var alarms []string
+		for conclusion := range stream.Conclusions() {
+			alarms = append(alarms, conclusion.Text)
+		}
+		assert.NilError(t, stream.Wait())
+		assert.DeepEqual(t, alarms, []string{`(alarm (sensor 20))`, `(alarm (sensor restarted))`})
+	})
+
+	t.Run("One at a time", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		in := make(chan interface{})
+		stream, err := env.Stream(context.Background(), in, StreamOptions{})
+		assert.NilError(t, err)
+		_, err = env.Stream(context.Background(), in, StreamOptions{})
+		assert.ErrorContains(t, err, "already has a running stream")
+
+		close(in)
+		assert.NilError(t, stream.Wait())
+		done := make(chan interface{})
+		close(done)
+		stream, err = env.Stream(context.Background(), done, StreamOptions{})
+		assert.NilError(t, err)
+		assert.NilError(t, stream.Wait())
+	})
+
+	t.Run("Deleted", func(t *testing.T) {
+		env := CreateEnvironment()
+
+		err := env.Build(`(defrule forever (count ?x) => (assert (count (+ ?x 1))))`)
+		assert.NilError(t, err)
+
+		in := make(chan interface{}, 1)
+		in <- `(count 0)`
+		stream, err := env.Stream(context.Background(), in, StreamOptions{})
+		assert.NilError(t, err)
+		// the agenda never empties, so the stream only stops once halted
+		env.Delete()
+		assert.Equal(t, stream.Wait(), context.Canceled)
+	})
+
+	t.Run("Instances", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := env.InsertClass(StreamReading{})
+		assert.NilError(t, err)
+		err = env.Build(`(defclass Alarm (is-a USER) (slot sensor))`)
+		assert.NilError(t, err)
+		err = env.Build(`(defrule too-hot
+			(object (is-a StreamReading) (Sensor ?s) (Value ?v&:(> ?v 100.0)))
+			=>
+			(make-instance of Alarm (sensor ?s)))`)
+		assert.NilError(t, err)
+
+		in := make(chan interface{}, 3)
+		in <- StreamReading{Sensor: "a", Value: 120}
+		in <- StreamReading{Sensor: "b", Value: 20}
+		in <- nil
+		close(in)
+		var failed []interface{}
+		stream, err := env.Stream(context.Background(), in, StreamOptions{
+			Insert:  true,
+			Classes: []string{"Alarm"},
+			OnError: func(value interface{}, err error) {
+				failed = append(failed, value)
+			},
+		})
+		assert.NilError(t, err)
+
+		var alarms []Conclusion
+		for conclusion := range stream.Conclusions() {
+			alarms = append(alarms, conclusion)
+		}
+		assert.NilError(t, stream.Wait())
+		assert.Equal(t, len(failed), 1)
+		assert.Equal(t, len(alarms), 1)
+		assert.Equal(t, alarms[0].Slots["sensor"], "a")
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		in := make(chan interface{}, 1)
+		in <- `(unbalanced`
+		stream, err := env.Stream(context.Background(), in, StreamOptions{})
+		assert.NilError(t, err)
+		for range stream.Conclusions() {
+		}
+		assert.ErrorContains(t, stream.Wait(), "Unable to load")
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(defrule echo (ping ?x) => (assert (pong ?x)))`)
+		assert.NilError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		in := make(chan interface{})
+		stream, err := env.Stream(ctx, in, StreamOptions{
+			Templates: []string{"pong"},
+		})
+		assert.NilError(t, err)
+		in <- `(ping 1)`
+		conclusion := <-stream.Conclusions()
+		assert.Equal(t, conclusion.Text, "(pong 1)")
+
+		// nothing reads the conclusion of this one, so the stream is blocked sending it
+		in <- `(ping 2)`
+		cancel()
+		for range stream.Conclusions() {
+		}
+		assert.Equal(t, stream.Wait(), context.Canceled)
+	})
+}
@@ -0,0 +1,202 @@
+package clips
+
+// #cgo CFLAGS: -I ../../clips_source
+// #cgo LDFLAGS: -L ../../clips_source -l clips -lm
+// #include <clips/clips.h>
+//
+// void *executing_rule(void *env)
+// {
+//   return EngineData(env)->ExecutingRule;
+// }
+import "C"
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// LogLevel is the severity of a structured log record
+type LogLevel int
+
+const (
+	LOG_DEBUG LogLevel = iota
+	LOG_INFO
+	LOG_WARNING
+	LOG_ERROR
+)
+
+var clipsLogLevels = [...]string{
+	"DEBUG",
+	"INFO",
+	"WARNING",
+	"ERROR",
+}
+
+func (lvl LogLevel) String() string {
+	if lvl < 0 || int(lvl) >= len(clipsLogLevels) {
+		return fmt.Sprintf("LogLevel(%d)", lvl)
+	}
+	return clipsLogLevels[int(lvl)]
+}
+
+// Attribute names attached to each structured log record
+const (
+	LogAttrEnvironment = "env"
+	LogAttrLogicalName = "logical_name"
+	LogAttrRule        = "rule"
+	LogAttrModule      = "module"
+)
+
+// StructuredLogger receives log records from a StructuredLoggingRouter. attrs
+// contains the environment ID, the logical name the message was printed to, the
+// current module and, if a rule is firing, the name of that rule
+type StructuredLogger interface {
+	Log(level LogLevel, message string, attrs map[string]interface{})
+}
+
+// StructuredLoggerFunc adapts an ordinary function to a StructuredLogger
+type StructuredLoggerFunc func(level LogLevel, message string, attrs map[string]interface{})
+
+// Log calls f
+func (f StructuredLoggerFunc) Log(level LogLevel, message string, attrs map[string]interface{}) {
+	f(level, message, attrs)
+}
+
+// JSONLogger is a StructuredLogger that writes each record as a line of JSON
+type JSONLogger struct {
+	encoder *json.Encoder
+}
+
+// StructuredLoggingRouter is a router that sends each line of output to a
+// StructuredLogger, at a level determined by the logical name
+type StructuredLoggingRouter struct {
+	core    *RouterCore
+	logger  StructuredLogger
+	linebuf map[string]*bytes.Buffer
+}
+
+var structuredLogLevels = map[string]LogLevel{
+	"wtrace":   LOG_DEBUG,
+	"stdout":   LOG_INFO,
+	"wclips":   LOG_INFO,
+	"wdialog":  LOG_INFO,
+	"wdisplay": LOG_INFO,
+	"wwarning": LOG_WARNING,
+	"werror":   LOG_ERROR,
+}
+
+// CreateStructuredLoggingRouter returns a new structured logging router
+func CreateStructuredLoggingRouter(env *Environment, logger StructuredLogger) *StructuredLoggingRouter {
+	ret := &StructuredLoggingRouter{
+		logger:  logger,
+		linebuf: make(map[string]*bytes.Buffer),
+	}
+	ret.core = CreateRouterCore(env, ret, ioRouterName("structured-logging"), loggingHandlers, 30)
+	return ret
+}
+
+// Name of this router
+func (r *StructuredLoggingRouter) Name() string {
+	return r.core.Name()
+}
+
+// Query should return true if the router handles the given logical IO name
+func (r *StructuredLoggingRouter) Query(name string) bool {
+	return r.core.Query(name)
+}
+
+// Print is called with a message if Query has returned true
+func (r *StructuredLoggingRouter) Print(name string, message string) {
+	buf, ok := r.linebuf[name]
+	if !ok {
+		buf = &bytes.Buffer{}
+		r.linebuf[name] = buf
+	}
+	buf.WriteString(message)
+	for strings.Contains(buf.String(), "\n") {
+		// each record is one line, so we don't log till we have one
+		line, _ := buf.ReadString('\n')
+		r.logger.Log(structuredLogLevels[name], strings.TrimRight(line, "\n"), r.attributes(name))
+	}
+}
+
+func (r *StructuredLoggingRouter) attributes(name string) map[string]interface{} {
+	env := r.core.env
+	ret := map[string]interface{}{
+		LogAttrEnvironment: env.ID(),
+		LogAttrLogicalName: name,
+		LogAttrModule:      env.CurrentModule().Name(),
+	}
+	if rptr := C.executing_rule(env.env); rptr != nil {
+		ret[LogAttrRule] = createRule(env, rptr).Name()
+	}
+	return ret
+}
+
+// Getc is called by CLIPS to obtain a character from input
+func (r *StructuredLoggingRouter) Getc(name string) byte {
+	return 0
+}
+
+// Ungetc is called by CLIPS to push a character back into the input queue
+func (r *StructuredLoggingRouter) Ungetc(name string, ch byte) error {
+	return fmt.Errorf("Not implemented")
+}
+
+// Exit is called by CLIPS before CLIPS itself exits
+func (r *StructuredLoggingRouter) Exit(exitcode int) {
+	log.Println("CLIPS will exit")
+}
+
+// Activate activates this router with the Env
+func (r *StructuredLoggingRouter) Activate() error {
+	return r.core.Activate()
+}
+
+// Deactivate deactivates this router with the Env
+func (r *StructuredLoggingRouter) Deactivate() error {
+	return r.core.Deactivate()
+}
+
+// Delete removes this router from the Env
+func (r *StructuredLoggingRouter) Delete() error {
+	return r.core.Delete()
+}
+
+// CreateJSONLogger returns a StructuredLogger writing one JSON object per record
+// to w. Each object holds the level, the message and all of the attributes
+func CreateJSONLogger(w io.Writer) *JSONLogger {
+	return &JSONLogger{
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// Log writes the record as a line of JSON
+func (l *JSONLogger) Log(level LogLevel, message string, attrs map[string]interface{}) {
+	record := make(map[string]interface{}, len(attrs)+2)
+	for k, v := range attrs {
+		record[k] = v
+	}
+	record["level"] = level.String()
+	record["msg"] = message
+	if err := l.encoder.Encode(record); err != nil {
+		log.Printf("Unable to write log record: %v", err)
+	}
+}
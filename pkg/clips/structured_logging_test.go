@@ -0,0 +1,150 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+type logRecord struct {
+	level   LogLevel
+	message string
+	attrs   map[string]interface{}
+}
+
+func TestStructuredLoggingRouter(t *testing.T) {
+	t.Run("Levels", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		records := make([]logRecord, 0)
+		lr := CreateStructuredLoggingRouter(env, StructuredLoggerFunc(func(level LogLevel, message string, attrs map[string]interface{}) {
+			records = append(records, logRecord{level, message, attrs})
+		}))
+		defer lr.Delete()
+
+		_, err := env.Eval(`(printout wwarning "careful")`)
+		assert.NilError(t, err)
+		// unfinished line should be buffered
+		assert.Equal(t, len(records), 0)
+		_, err = env.Eval(`(printout wdisplay "shown" crlf)`)
+		assert.NilError(t, err)
+		_, err = env.Eval(`(printout wwarning crlf)`)
+		assert.NilError(t, err)
+		_, err = env.Eval(`(printout wtrace "traced" crlf)`)
+		assert.NilError(t, err)
+
+		assert.Equal(t, len(records), 3)
+		assert.Equal(t, records[0].level, LOG_INFO)
+		assert.Equal(t, records[0].message, "shown")
+		assert.Equal(t, records[1].level, LOG_WARNING)
+		assert.Equal(t, records[1].message, "careful")
+		assert.Equal(t, records[2].level, LOG_DEBUG)
+		assert.Equal(t, records[2].message, "traced")
+
+		records = records[:0]
+		_, err = env.Eval("(create$ 1 2 3")
+		assert.ErrorContains(t, err, "EXPRNPSR2")
+		assert.Assert(t, len(records) > 0)
+		for _, record := range records {
+			assert.Equal(t, record.level, LOG_ERROR)
+		}
+	})
+
+	t.Run("Level names", func(t *testing.T) {
+		assert.Equal(t, LOG_WARNING.String(), "WARNING")
+		assert.Equal(t, LogLevel(7).String(), "LogLevel(7)")
+		assert.Equal(t, LogLevel(-1).String(), "LogLevel(-1)")
+	})
+
+	t.Run("Two routers", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		var first, second []string
+		lr1 := CreateStructuredLoggingRouter(env, StructuredLoggerFunc(func(level LogLevel, message string, attrs map[string]interface{}) {
+			first = append(first, message)
+		}))
+		lr2 := CreateStructuredLoggingRouter(env, StructuredLoggerFunc(func(level LogLevel, message string, attrs map[string]interface{}) {
+			second = append(second, message)
+		}))
+		defer lr2.Delete()
+
+		// each router has a name of its own, so deleting one leaves the other
+		lr1.Delete()
+		_, err := env.Eval(`(printout wdisplay "shown" crlf)`)
+		assert.NilError(t, err)
+		assert.Equal(t, len(first), 0)
+		assert.DeepEqual(t, second, []string{"shown"})
+	})
+
+	t.Run("Attributes", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(defrule warn-me => (printout wwarning "from a rule" crlf))`)
+		assert.NilError(t, err)
+
+		records := make([]logRecord, 0)
+		lr := CreateStructuredLoggingRouter(env, StructuredLoggerFunc(func(level LogLevel, message string, attrs map[string]interface{}) {
+			records = append(records, logRecord{level, message, attrs})
+		}))
+		defer lr.Delete()
+
+		_, err = env.Eval(`(printout t "outside" crlf)`)
+		assert.NilError(t, err)
+		env.Run(-1)
+
+		assert.Equal(t, len(records), 2)
+		assert.DeepEqual(t, records[0].attrs, map[string]interface{}{
+			LogAttrEnvironment: env.ID(),
+			LogAttrLogicalName: "stdout",
+			LogAttrModule:      "MAIN",
+		})
+		assert.DeepEqual(t, records[1].attrs, map[string]interface{}{
+			LogAttrEnvironment: env.ID(),
+			LogAttrLogicalName: "wwarning",
+			LogAttrModule:      "MAIN",
+			LogAttrRule:        "warn-me",
+		})
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		var buf bytes.Buffer
+		lr := CreateStructuredLoggingRouter(env, CreateJSONLogger(&buf))
+		defer lr.Delete()
+
+		_, err := env.Eval(`(printout wwarning "careful" crlf)`)
+		assert.NilError(t, err)
+
+		var record map[string]interface{}
+		err = json.Unmarshal(buf.Bytes(), &record)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, record, map[string]interface{}{
+			"level":        "WARNING",
+			"msg":          "careful",
+			"env":          float64(env.ID()),
+			"logical_name": "wwarning",
+			"module":       "MAIN",
+		})
+	})
+}
@@ -5,6 +5,22 @@ package clips
 // #include <clips/clips.h>
 //
 // int implied_deftemplate(void*);
+//
+// /* which types the allowed values restrict, as bits: 1 for every type, as allowed-values does,
+//    then SYMBOL, STRING, FLOAT, INTEGER and INSTANCE-NAME */
+// int slot_restrictions(void *env, void *template, const char *name)
+// {
+//   short position;
+//   struct templateSlot *slot;
+//   CONSTRAINT_RECORD *cr;
+//
+//   slot = FindSlot((struct deftemplate *) template, (SYMBOL_HN *) EnvAddSymbol(env, name), &position);
+//   if (slot == NULL || (cr = slot->constraints) == NULL) {
+//     return 0;
+//   }
+//   return (cr->anyRestriction ? 1 : 0) | (cr->symbolRestriction ? 2 : 0) | (cr->stringRestriction ? 4 : 0) |
+//     (cr->floatRestriction ? 8 : 0) | (cr->integerRestriction ? 16 : 0) | (cr->instanceNameRestriction ? 32 : 0);
+// }
 import "C"
 /*
    Copyright 2020 Keysight Technologies
@@ -21,6 +37,8 @@ import "C"
 */
 import (
 	"fmt"
+	"reflect"
+	"sort"
 	"strings"
 	"unsafe"
 )
@@ -167,6 +185,111 @@ func (t *Template) NewFact() (Fact, error) {
 	return t.env.newFact(unsafe.Pointer(factptr)), nil
 }
 
+// Assert asserts a fact of this template with the given slot values. Slots that are not given are
+// filled with their defaults, as for NewFact. Slot names and values are checked against the
+// template first, so that an unknown slot, a missing required slot or a value that violates a
+// slot's constraints is reported before anything is asserted. For an implied template, the only
+// slot is "", holding a list of values
+func (t *Template) Assert(slots map[string]interface{}) (Fact, error) {
+	if t.Implied() {
+		return t.assertImplied(slots)
+	}
+	defs := t.Slots()
+	for name, value := range slots {
+		slot, ok := defs[name]
+		if !ok {
+			return nil, fmt.Errorf(`Template "%s" has no slot "%s"`, t.Name(), name)
+		}
+		if err := slot.Check(value); err != nil {
+			return nil, err
+		}
+	}
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := slots[name]; !ok && defs[name].DefaultType() == NO_DEFAULT {
+			return nil, fmt.Errorf(`Slot "%s" of template "%s" has no default, so a value must be given`, name, t.Name())
+		}
+	}
+
+	fact, err := t.NewFact()
+	if err != nil {
+		return nil, err
+	}
+	tfact := fact.(*TemplateFact)
+	for name, value := range slots {
+		if err := tfact.Set(name, value); err != nil {
+			tfact.Drop()
+			return nil, err
+		}
+	}
+	if err := tfact.Assert(); err != nil {
+		tfact.Drop()
+		return nil, err
+	}
+	return tfact, nil
+}
+
+func (t *Template) assertImplied(slots map[string]interface{}) (Fact, error) {
+	var values []interface{}
+	for name, value := range slots {
+		if name != "" {
+			return nil, fmt.Errorf(`Implied template "%s" has no slot "%s"`, t.Name(), name)
+		}
+		val := reflect.ValueOf(value)
+		if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+			return nil, fmt.Errorf(`Implied template "%s" expects a list of values, got %T`, t.Name(), value)
+		}
+		var err error
+		if values, err = t.env.compatibleList(val); err != nil {
+			return nil, err
+		}
+	}
+	fact, err := t.NewFact()
+	if err != nil {
+		return nil, err
+	}
+	ifact := fact.(*ImpliedFact)
+	if err := ifact.Extend(values); err != nil {
+		ifact.Drop()
+		return nil, err
+	}
+	if err := ifact.Assert(); err != nil {
+		ifact.Drop()
+		return nil, err
+	}
+	return ifact, nil
+}
+
+// AssertStruct asserts a fact of this template with the slot values of the given struct, named as
+// for InsertTemplate and checked as for Assert. The struct's type need not be the one the template
+// was inserted from, as long as its slots match. Nested structs are asserted as by
+// Environment.AssertStruct with the same options, and retracted again if the fact is invalid
+func (t *Template) AssertStruct(v interface{}, opts ...InsertClassOption) (Fact, error) {
+	val := reflect.ValueOf(v)
+	if val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return nil, fmt.Errorf(`Unable to assert fact for type "%T"`, v)
+	}
+	knownFacts := make(map[reflect.Value]Fact)
+	slots, err := t.env.structSlotValues(val, knownFacts, map[reflect.Value]bool{val: true}, opts...)
+	if err != nil {
+		retractNested(knownFacts)
+		return nil, err
+	}
+	fact, err := t.Assert(slots)
+	if err != nil {
+		retractNested(knownFacts)
+		return nil, err
+	}
+	return fact, nil
+}
+
 // Undefine the template. Equivalent to (undeftemplate). This object is unusable after this call
 func (t *Template) Undefine() error {
 	ret := C.EnvUndeftemplate(t.env.env, t.tplptr)
@@ -333,3 +456,104 @@ func (ts *TemplateSlot) AllowedValues() (values []interface{}, ok bool) {
 	values, ok = dv.([]interface{})
 	return
 }
+
+// Check returns an error if value does not satisfy the constraints of this slot: its types,
+// allowed values and range, and for a multislot its cardinality
+func (ts *TemplateSlot) Check(value interface{}) error {
+	value, err := ts.tpl.env.canonicalValue(value)
+	if err != nil {
+		return fmt.Errorf(`Invalid value for slot "%s": %v`, ts.name, err)
+	}
+	values, multi := value.([]interface{})
+	if ts.Multifield() {
+		if !multi {
+			values = []interface{}{value}
+		}
+		low, high, hasHigh := ts.Cardinality()
+		if int64(len(values)) < low || (hasHigh && int64(len(values)) > high) {
+			return fmt.Errorf(`Slot "%s" does not allow %d values`, ts.name, len(values))
+		}
+	} else if multi {
+		return fmt.Errorf(`Slot "%s" is a single-field slot and can not hold a multifield`, ts.name)
+	} else {
+		values = []interface{}{value}
+	}
+	types := ts.Types()
+	allowed, _ := ts.AllowedValues()
+	restricted := ts.restrictedTypes()
+	for _, v := range values {
+		if err := ts.checkField(v, types, allowed, restricted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restrictedTypes returns the types whose values must be among the allowed values. allowed-values
+// restricts every type, while allowed-symbols and the like restrict only their own
+func (ts *TemplateSlot) restrictedTypes() func(Type) bool {
+	cname := C.CString(ts.name)
+	defer C.free(unsafe.Pointer(cname))
+	bits := int(C.slot_restrictions(ts.tpl.env.env, ts.tpl.tplptr, cname))
+	return func(typ Type) bool {
+		switch {
+		case bits&1 != 0:
+			return true
+		case typ == SYMBOL:
+			return bits&2 != 0
+		case typ == STRING:
+			return bits&4 != 0
+		case typ == FLOAT:
+			return bits&8 != 0
+		case typ == INTEGER:
+			return bits&16 != 0
+		case typ == INSTANCE_NAME:
+			return bits&32 != 0
+		}
+		return false
+	}
+}
+
+func (ts *TemplateSlot) checkField(value interface{}, types []Symbol, allowed []interface{}, restricted func(Type) bool) error {
+	typ := clipsTypeFor(reflect.TypeOf(value))
+	// Types uses the CLIPS spelling, e.g. FACT-ADDRESS
+	typname := Symbol(strings.Replace(typ.String(), "_", "-", -1))
+	found := false
+	for _, t := range types {
+		if t == typname {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf(`Slot "%s" does not allow %s value %v`, ts.name, typname, value)
+	}
+	if restricted(typ) {
+		found = false
+		for _, a := range allowed {
+			if sameValue(a, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf(`Value %v is not an allowed value of slot "%s"`, value, ts.name)
+		}
+	}
+	var num float64
+	switch v := value.(type) {
+	case int64:
+		num = float64(v)
+	case float64:
+		num = v
+	default:
+		return nil
+	}
+	ilow, hasILow, ihigh, hasIHigh := ts.IntRange()
+	flow, hasFLow, fhigh, hasFHigh := ts.FloatRange()
+	if (hasILow && num < float64(ilow)) || (hasFLow && num < flow) ||
+		(hasIHigh && num > float64(ihigh)) || (hasFHigh && num > fhigh) {
+		return fmt.Errorf(`Value %v is out of range for slot "%s"`, value, ts.name)
+	}
+	return nil
+}
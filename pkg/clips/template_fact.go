@@ -19,7 +19,9 @@ import "C"
 */
 import (
 	"fmt"
+	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"unsafe"
 )
@@ -36,38 +38,42 @@ func createTemplateFact(env *Environment, factptr unsafe.Pointer) *TemplateFact
 		factptr: factptr,
 	}
 	C.EnvIncrementFactCount(env.env, factptr)
-	runtime.SetFinalizer(ret, func(*TemplateFact) {
-		ret.Drop()
+	// the finalizer must not refer to ret, or ret would never become unreachable
+	runtime.SetFinalizer(ret, func(f *TemplateFact) {
+		f.Drop()
 	})
 	return ret
 }
 
-// Drop drops the reference to the fact in CLIPS. should be called when done with the fact
+// Drop drops the reference to the fact in CLIPS. This happens automatically when the fact is
+// garbage collected, but may be called to release it sooner. It is safe to call more than once
 func (f *TemplateFact) Drop() {
 	if f.factptr != nil {
-		C.EnvDecrementFactCount(f.env.env, f.factptr)
+		if f.env.env != nil {
+			C.EnvDecrementFactCount(f.env.env, f.factptr)
+		}
 		f.factptr = nil
 	}
 }
 
 // Index returns the index number of this fact within CLIPS
 func (f *TemplateFact) Index() int {
+	if f.factptr == nil || f.env.env == nil {
+		return 0
+	}
 	return int(C.EnvFactIndex(f.env.env, f.factptr))
 }
 
 // Asserted returns true if the fact has been asserted.
 func (f *TemplateFact) Asserted() bool {
-	if f.Index() == 0 {
-		return false
-	}
-	if C.EnvFactExistp(f.env.env, f.factptr) != 1 {
-		return false
-	}
-	return true
+	return checkFact(f.env, f.factptr) == nil && f.Index() != 0
 }
 
 // Assert asserts the fact
 func (f *TemplateFact) Assert() error {
+	if err := checkFact(f.env, f.factptr); err != nil {
+		return err
+	}
 	if f.Asserted() {
 		return fmt.Errorf("Fact already asserted")
 	}
@@ -86,6 +92,9 @@ func (f *TemplateFact) Assert() error {
 
 // Retract retracts the fact from CLIPS
 func (f *TemplateFact) Retract() error {
+	if err := checkFact(f.env, f.factptr); err != nil {
+		return err
+	}
 	ret := C.EnvRetract(f.env.env, f.factptr)
 	if ret != 1 {
 		return EnvError(f.env, "Unable to retract fact")
@@ -95,12 +104,18 @@ func (f *TemplateFact) Retract() error {
 
 // Template returns the template defining this fact
 func (f *TemplateFact) Template() *Template {
+	if f.factptr == nil || f.env.env == nil {
+		return nil
+	}
 	tplptr := C.EnvFactDeftemplate(f.env.env, f.factptr)
 	return createTemplate(f.env, tplptr)
 }
 
 // String returns a string representation of the fact
 func (f *TemplateFact) String() string {
+	if f.factptr == nil || f.env.env == nil {
+		return ""
+	}
 	ret := factPPString(f.env, f.factptr)
 	split := strings.SplitN(ret, "     ", 2)
 	return strings.TrimRight(split[len(split)-1], "\n")
@@ -117,6 +132,9 @@ func (f *TemplateFact) Equal(otherfact Fact) bool {
 
 // Slots returns a function that can be called to get the next slot for this fact. Will return nil when no more slots remain
 func (f *TemplateFact) Slots() (map[string]interface{}, error) {
+	if err := checkFact(f.env, f.factptr); err != nil {
+		return nil, err
+	}
 	data := createDataObject(f.env)
 	defer data.Delete()
 
@@ -147,6 +165,9 @@ func (f *TemplateFact) Slots() (map[string]interface{}, error) {
 
 // Slot returns the value stored in the given slot
 func (f *TemplateFact) Slot(name string) (interface{}, error) {
+	if err := checkFact(f.env, f.factptr); err != nil {
+		return nil, err
+	}
 	data, err := slotValue(f.env, f.factptr, Symbol(name))
 	if err != nil {
 		return nil, err
@@ -157,6 +178,9 @@ func (f *TemplateFact) Slot(name string) (interface{}, error) {
 
 // ExtractSlot unmarshals the given slot value into the object provided by the user
 func (f *TemplateFact) ExtractSlot(retval interface{}, name string) error {
+	if err := checkFact(f.env, f.factptr); err != nil {
+		return err
+	}
 	data, err := slotValue(f.env, f.factptr, Symbol(name))
 	if err != nil {
 		return err
@@ -167,6 +191,9 @@ func (f *TemplateFact) ExtractSlot(retval interface{}, name string) error {
 
 // Set alters the item at a specific in the multifield
 func (f *TemplateFact) Set(slot string, value interface{}) error {
+	if err := checkFact(f.env, f.factptr); err != nil {
+		return err
+	}
 	if f.Asserted() {
 		return fmt.Errorf("Unable to change asserted fact")
 	}
@@ -175,7 +202,9 @@ func (f *TemplateFact) Set(slot string, value interface{}) error {
 	cslot := C.CString(slot)
 	defer C.free(unsafe.Pointer(cslot))
 
-	data.SetValue(value)
+	if err := data.SetValue(value); err != nil {
+		return fmt.Errorf(`Unable to set slot "%s": %v`, slot, err)
+	}
 
 	ret := C.EnvPutFactSlot(f.env.env, f.factptr, cslot, data.byRef())
 	if ret != 1 {
@@ -198,3 +227,106 @@ func (f *TemplateFact) Extract(retval interface{}) error {
 	knownInstances := make(map[InstanceName]interface{})
 	return f.env.structuredExtract(retval, slots, false, knownInstances)
 }
+
+// Modify changes the given slots of an asserted fact, as the CLIPS modify command does: the fact is
+// retracted, and a new fact with the changed values is asserted and returned. Every value is
+// checked against the slot's constraints before anything changes
+func (f *TemplateFact) Modify(changes map[string]interface{}) (Fact, error) {
+	return f.modify("modify", changes)
+}
+
+// Duplicate asserts and returns a copy of this fact with the given slots changed, as the CLIPS
+// duplicate command does. Every value is checked against the slot's constraints first
+func (f *TemplateFact) Duplicate(changes map[string]interface{}) (Fact, error) {
+	return f.modify("duplicate", changes)
+}
+
+// ModifyStruct modifies the fact to match the given struct, as if it had been asserted by
+// AssertStruct with the same options. Only the slots whose values have changed are modified, and if
+// none have the fact is returned as it is
+func (f *TemplateFact) ModifyStruct(v interface{}, opts ...InsertClassOption) (Fact, error) {
+	val := reflect.ValueOf(v)
+	if val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return nil, fmt.Errorf(`Unable to modify fact from type "%T"`, v)
+	}
+	current, err := f.Slots()
+	if err != nil {
+		return nil, err
+	}
+	knownFacts := make(map[reflect.Value]Fact)
+	slots, err := f.env.structSlotValues(val, knownFacts, map[reflect.Value]bool{val: true}, opts...)
+	if err != nil {
+		retractNested(knownFacts)
+		return nil, err
+	}
+	changes := make(map[string]interface{})
+	for name, slotval := range slots {
+		canonical, err := f.env.canonicalValue(slotval)
+		if err != nil {
+			retractNested(knownFacts)
+			return nil, fmt.Errorf(`Invalid value for slot "%s": %v`, name, err)
+		}
+		if old, ok := current[name]; !ok || !sameValue(old, canonical) {
+			changes[name] = slotval
+		}
+	}
+	if len(changes) == 0 {
+		return f, nil
+	}
+	fact, err := f.Modify(changes)
+	if err != nil {
+		retractNested(knownFacts)
+		return nil, err
+	}
+	return fact, nil
+}
+
+// modify runs the CLIPS modify or duplicate command through a deffunction taking the slot values
+func (f *TemplateFact) modify(command string, changes map[string]interface{}) (Fact, error) {
+	if err := checkFact(f.env, f.factptr); err != nil {
+		return nil, err
+	}
+	if !f.Asserted() {
+		return nil, fmt.Errorf("Unable to %s fact that has not been asserted", command)
+	}
+	slots := f.Template().Slots()
+	names := make([]string, 0, len(changes))
+	for name, value := range changes {
+		slot, ok := slots[name]
+		if !ok {
+			return nil, fmt.Errorf(`Fact %d does not have slot "%s"`, f.Index(), name)
+		}
+		if err := slot.Check(value); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	vars := make([]string, len(names))
+	overrides := make([]string, len(names))
+	args := make([]interface{}, 0, len(names)+1)
+	args = append(args, f)
+	for ii, name := range names {
+		vars[ii] = fmt.Sprintf("?v%d", ii)
+		overrides[ii] = fmt.Sprintf("(%s %s)", name, vars[ii])
+		args = append(args, changes[name])
+	}
+	body := fmt.Sprintf("(?f %s) (%s ?f %s)", strings.Join(vars, " "), command, strings.Join(overrides, " "))
+	name, err := f.env.generatedFunction("clipsgo-"+command, body)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := f.env.Call(name, args...)
+	if err != nil {
+		return nil, err
+	}
+	fact, ok := ret.(Fact)
+	if !ok {
+		return nil, EnvError(f.env, "Unable to %s fact", command)
+	}
+	return fact, nil
+}
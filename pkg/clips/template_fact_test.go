@@ -270,3 +270,144 @@ func TestTemplateFact(t *testing.T) {
 		assert.Assert(t, fact.Equal(factlist[1]))
 	})
 }
+
+type ModifiedPoint struct {
+	X int
+	Y int
+}
+
+func TestModifyFact(t *testing.T) {
+	t.Run("Modify", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(deftemplate foo (slot bar (type INTEGER) (range 0 10)) (multislot baz))")
+		assert.NilError(t, err)
+
+		fact, err := env.AssertString(`(foo (bar 4) (baz a b c))`)
+		assert.NilError(t, err)
+		tfact := fact.(*TemplateFact)
+		count := len(env.Facts())
+
+		modified, err := tfact.Modify(map[string]interface{}{
+			"bar": 5,
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, modified.String(), "(foo (bar 5) (baz a b c))")
+		assert.Equal(t, len(env.Facts()), count)
+
+		// the original was retracted
+		_, err = tfact.Slot("bar")
+		assert.Equal(t, err, ErrStale)
+	})
+
+	t.Run("Modify multislot", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(deftemplate foo (slot bar) (multislot baz))")
+		assert.NilError(t, err)
+
+		fact, err := env.AssertString(`(foo (bar 4) (baz a))`)
+		assert.NilError(t, err)
+
+		fact, err = fact.(*TemplateFact).Modify(map[string]interface{}{
+			"baz": []interface{}{Symbol("x"), Symbol("y")},
+			"bar": 5,
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, fact.String(), "(foo (bar 5) (baz x y))")
+
+		fact, err = fact.(*TemplateFact).Modify(map[string]interface{}{
+			"baz": []interface{}{1, "two", Symbol("three")},
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, fact.String(), `(foo (bar 5) (baz 1 "two" three))`)
+
+		fact, err = fact.(*TemplateFact).Modify(map[string]interface{}{
+			"baz": []interface{}{},
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, fact.String(), "(foo (bar 5) (baz))")
+
+		dup, err := fact.(*TemplateFact).Duplicate(map[string]interface{}{
+			"baz": []interface{}{Symbol("p"), Symbol("q")},
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, dup.String(), "(foo (bar 5) (baz p q))")
+	})
+
+	t.Run("Constraints checked first", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(deftemplate foo (slot bar (type INTEGER) (range 0 10)) (multislot baz))")
+		assert.NilError(t, err)
+
+		fact, err := env.AssertString(`(foo (bar 4))`)
+		assert.NilError(t, err)
+		tfact := fact.(*TemplateFact)
+
+		_, err = tfact.Modify(map[string]interface{}{
+			"baz": []interface{}{Symbol("x")},
+			"bar": 50,
+		})
+		assert.ErrorContains(t, err, "out of range")
+		_, err = tfact.Modify(map[string]interface{}{
+			"nosuch": 1,
+		})
+		assert.ErrorContains(t, err, `does not have slot "nosuch"`)
+
+		// nothing changed
+		assert.Assert(t, tfact.Asserted())
+		assert.Equal(t, tfact.String(), "(foo (bar 4) (baz))")
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build("(deftemplate foo (slot bar) (multislot baz))")
+		assert.NilError(t, err)
+
+		fact, err := env.AssertString(`(foo (bar 4) (baz a b c))`)
+		assert.NilError(t, err)
+		tfact := fact.(*TemplateFact)
+		count := len(env.Facts())
+
+		dup, err := tfact.Duplicate(map[string]interface{}{
+			"baz": []string{"d"},
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, dup.String(), `(foo (bar 4) (baz "d"))`)
+		assert.Assert(t, tfact.Asserted())
+		assert.Equal(t, len(env.Facts()), count+1)
+
+		unasserted, err := tfact.Template().NewFact()
+		assert.NilError(t, err)
+		_, err = unasserted.(*TemplateFact).Duplicate(nil)
+		assert.ErrorContains(t, err, "not been asserted")
+	})
+
+	t.Run("Modify struct", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		fact, err := env.AssertStruct(ModifiedPoint{X: 1, Y: 2})
+		assert.NilError(t, err)
+		tfact := fact.(*TemplateFact)
+
+		// unchanged
+		same, err := tfact.ModifyStruct(ModifiedPoint{X: 1, Y: 2})
+		assert.NilError(t, err)
+		assert.Assert(t, same.Equal(tfact))
+
+		modified, err := tfact.ModifyStruct(&ModifiedPoint{X: 1, Y: 3})
+		assert.NilError(t, err)
+		var out ModifiedPoint
+		err = modified.Extract(&out)
+		assert.NilError(t, err)
+		assert.Equal(t, out, ModifiedPoint{X: 1, Y: 3})
+		assert.Assert(t, !tfact.Asserted())
+	})
+}
@@ -449,4 +449,116 @@ func TestTemplateSlot(t *testing.T) {
 		})
 	})
 
+	t.Run("TemplateSlot check", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(deftemplate foo
+			(slot bar (type INTEGER) (range 0 10))
+			(slot color (type SYMBOL) (allowed-symbols red green))
+			(slot size (type SYMBOL STRING INTEGER) (allowed-values small "big" 3))
+			(slot shade (type SYMBOL STRING) (allowed-symbols dark))
+			(multislot baz (type SYMBOL STRING) (cardinality 0 2)))`)
+		assert.NilError(t, err)
+
+		tmpl, err := env.FindTemplate("foo")
+		assert.NilError(t, err)
+		slots := tmpl.Slots()
+
+		assert.NilError(t, slots["bar"].Check(5))
+		assert.ErrorContains(t, slots["bar"].Check(11), "out of range")
+		assert.ErrorContains(t, slots["bar"].Check("five"), "does not allow STRING")
+		assert.ErrorContains(t, slots["bar"].Check([]int{1}), "single-field")
+
+		assert.NilError(t, slots["color"].Check(Symbol("red")))
+		assert.ErrorContains(t, slots["color"].Check(Symbol("blue")), "not an allowed value")
+
+		// allowed-values restricts every type, allowed-symbols only symbols
+		assert.NilError(t, slots["size"].Check(Symbol("small")))
+		assert.NilError(t, slots["size"].Check("big"))
+		assert.NilError(t, slots["size"].Check(3))
+		assert.ErrorContains(t, slots["size"].Check("small"), "not an allowed value")
+		assert.ErrorContains(t, slots["size"].Check(4), "not an allowed value")
+		assert.NilError(t, slots["shade"].Check("light"))
+		assert.ErrorContains(t, slots["shade"].Check(Symbol("light")), "not an allowed value")
+
+		assert.NilError(t, slots["baz"].Check([]interface{}{Symbol("a"), "b"}))
+		assert.NilError(t, slots["baz"].Check(Symbol("a")))
+		assert.ErrorContains(t, slots["baz"].Check([]string{"a", "b", "c"}), "does not allow 3 values")
+	})
+}
+
+type AssertedPerson struct {
+	Name string `clips:"name"`
+	Age  int    `clips:"age"`
+}
+
+func TestTemplateAssert(t *testing.T) {
+	t.Run("Assert map", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(deftemplate person (slot name (type STRING)) (slot age (type INTEGER) (default 18)))`)
+		assert.NilError(t, err)
+		tmpl, err := env.FindTemplate("person")
+		assert.NilError(t, err)
+
+		fact, err := tmpl.Assert(map[string]interface{}{
+			"name": "bob",
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, fact.String(), `(person (name "bob") (age 18))`)
+	})
+
+	t.Run("Invalid slots", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(deftemplate person (slot name (type STRING) (default ?NONE)) (slot age (type INTEGER)))`)
+		assert.NilError(t, err)
+		tmpl, err := env.FindTemplate("person")
+		assert.NilError(t, err)
+		count := len(env.Facts())
+
+		_, err = tmpl.Assert(map[string]interface{}{"name": "bob", "height": 180})
+		assert.ErrorContains(t, err, `Template "person" has no slot "height"`)
+		_, err = tmpl.Assert(map[string]interface{}{"name": "bob", "age": "old"})
+		assert.ErrorContains(t, err, "does not allow STRING")
+		_, err = tmpl.Assert(map[string]interface{}{"age": 20})
+		assert.ErrorContains(t, err, `Slot "name" of template "person" has no default`)
+		assert.Equal(t, len(env.Facts()), count)
+	})
+
+	t.Run("Assert implied", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		fact, err := env.AssertString(`(foo a)`)
+		assert.NilError(t, err)
+		other, err := fact.Template().Assert(map[string]interface{}{
+			"": []interface{}{Symbol("b"), 2},
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, other.String(), "(foo b 2)")
+	})
+
+	t.Run("Assert struct", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(deftemplate person (slot name (type STRING)) (slot age (type INTEGER)))`)
+		assert.NilError(t, err)
+		tmpl, err := env.FindTemplate("person")
+		assert.NilError(t, err)
+
+		fact, err := tmpl.AssertStruct(&AssertedPerson{Name: "alice", Age: 40})
+		assert.NilError(t, err)
+		var out AssertedPerson
+		err = fact.Extract(&out)
+		assert.NilError(t, err)
+		assert.Equal(t, out, AssertedPerson{Name: "alice", Age: 40})
+
+		_, err = tmpl.AssertStruct(BulkRecord{})
+		assert.ErrorContains(t, err, "has no slot")
+	})
 }
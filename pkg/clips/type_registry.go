@@ -0,0 +1,112 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// RegisterType associates a CLIPS class with a Go struct type. When an instance is extracted into
+// an interface, such as interface{} or an interface its classes were inserted from, a new
+// struct of the type registered for the instance's class is filled in, rather than a map. If the
+// class itself isn't registered, the nearest registered superclass is used. If className is
+// empty, the class name is taken from the type as by InsertClass
+func (env *Environment) RegisterType(className string, goType reflect.Type) error {
+	if goType == nil {
+		return fmt.Errorf("Unable to register nil type")
+	}
+	if goType.Kind() == reflect.Ptr {
+		goType = goType.Elem()
+	}
+	if goType.Kind() != reflect.Struct {
+		return fmt.Errorf(`Unable to register non-struct type "%v"`, goType)
+	}
+	if className == "" {
+		var err error
+		if className, err = classNameFor(goType); err != nil {
+			return err
+		}
+	}
+	env.types[className] = goType
+	return nil
+}
+
+// RegisteredType returns the Go type registered for the named class, if any
+func (env *Environment) RegisteredType(className string) (reflect.Type, bool) {
+	typ, ok := env.types[className]
+	return typ, ok
+}
+
+// registeredType finds the type registered for cls or its nearest superclass that can be stored in target
+func (env *Environment) registeredType(cls *Class, target reflect.Type) (reflect.Type, bool) {
+	if len(env.types) == 0 {
+		return nil, false
+	}
+	candidates := []*Class{cls}
+	if supers, err := cls.Superclasses(true); err == nil {
+		candidates = append(candidates, supers...)
+	}
+	for _, candidate := range candidates {
+		typ, ok := env.types[candidate.Name()]
+		if !ok {
+			continue
+		}
+		if reflect.PtrTo(typ).AssignableTo(target) || typ.AssignableTo(target) {
+			return typ, true
+		}
+	}
+	return nil, false
+}
+
+// extractRegistered fills a new struct of the registered type from inst, and stores it in val,
+// which holds an interface. A pointer to the struct is stored if it satisfies the interface
+func (env *Environment) extractRegistered(val reflect.Value, inst *Instance, typ reflect.Type, knownInstances map[InstanceName]interface{}) error {
+	ptr := reflect.New(typ)
+	// later references to the instance, in a cycle, get the same pointer
+	holder := reflect.New(ptr.Type())
+	holder.Elem().Set(ptr)
+	knownInstances[inst.Name()] = holder.Interface()
+
+	if err := env.structuredExtract(ptr.Interface(), inst.Slots(true), true, knownInstances); err != nil {
+		return err
+	}
+	if ptr.Type().AssignableTo(val.Type()) {
+		val.Set(ptr)
+	} else {
+		val.Set(ptr.Elem())
+	}
+	return nil
+}
+
+// setKnown stores a previously extracted instance in val. The known value may be held by pointer
+// where val wants the struct, or vice versa
+func setKnown(val reflect.Value, known interface{}) {
+	knownVal := reflect.ValueOf(known).Elem()
+	switch {
+	case knownVal.Type().AssignableTo(val.Type()):
+		val.Set(knownVal)
+	case knownVal.Kind() == reflect.Ptr && knownVal.Elem().Type().AssignableTo(val.Type()):
+		val.Set(knownVal.Elem())
+	case reflect.PtrTo(knownVal.Type()).AssignableTo(val.Type()):
+		val.Set(reflect.ValueOf(known))
+	}
+}
+
+// polymorphicList returns true if the elements of data, a multifield, need extracting one by one
+// so that instances become registered types
+func (env *Environment) polymorphicList(data reflect.Value, target reflect.Type, extractClasses bool) bool {
+	return extractClasses && len(env.types) > 0 && data.Kind() == reflect.Slice && target.Kind() == reflect.Slice
+}
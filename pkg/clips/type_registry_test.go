@@ -0,0 +1,148 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"reflect"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+type RegistryNode struct {
+	Name string
+	Next interface{}
+}
+
+type Kennel struct {
+	Dogs []interface{}
+}
+
+func TestRegisterType(t *testing.T) {
+	t.Run("Register", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.RegisterType("", reflect.TypeOf((*RegistryNode)(nil)))
+		assert.NilError(t, err)
+		typ, ok := env.RegisteredType("RegistryNode")
+		assert.Assert(t, ok)
+		assert.Equal(t, typ, reflect.TypeOf(RegistryNode{}))
+
+		err = env.RegisterType("NUMBER", reflect.TypeOf(1))
+		assert.ErrorContains(t, err, "non-struct")
+	})
+
+	t.Run("Extract subclass", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := env.InsertClass((*Speaker)(nil))
+		assert.NilError(t, err)
+		_, err = env.InsertClass((*Puppy)(nil), EmbedAsSuperclass)
+		assert.NilError(t, err)
+		err = env.RegisterType("Dog", reflect.TypeOf(Dog{}))
+		assert.NilError(t, err)
+
+		inst, err := env.Insert("rex", &Puppy{
+			Dog: &Dog{
+				Animal: Animal{Name: "Rex", Legs: 4},
+				Breed:  "lab",
+			},
+			Age: 1,
+		}, EmbedAsSuperclass)
+		assert.NilError(t, err)
+
+		// Puppy isn't registered, so the nearest registered superclass is used
+		var out Speaker
+		err = inst.Extract(&out)
+		assert.NilError(t, err)
+		dog, ok := out.(*Dog)
+		assert.Assert(t, ok)
+		assert.DeepEqual(t, *dog, Dog{
+			Animal: Animal{Name: "Rex", Legs: 4},
+			Breed:  "lab",
+		})
+
+		// a concrete target is still filled as before
+		var puppy Puppy
+		err = inst.Extract(&puppy)
+		assert.NilError(t, err)
+		assert.Equal(t, puppy.Age, 1)
+	})
+
+	t.Run("Extract multislot", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.RegisterType("Dog", reflect.TypeOf(Dog{}))
+		assert.NilError(t, err)
+
+		inst, err := env.Insert("kennel", Kennel{
+			Dogs: []interface{}{
+				&Dog{Animal: Animal{Name: "Rex"}},
+				&Dog{Animal: Animal{Name: "Fido"}},
+			},
+		})
+		assert.NilError(t, err)
+
+		var out Kennel
+		err = inst.Extract(&out)
+		assert.NilError(t, err)
+		assert.Equal(t, len(out.Dogs), 2)
+		assert.Equal(t, out.Dogs[0].(*Dog).Name, "Rex")
+		assert.Equal(t, out.Dogs[1].(*Dog).Name, "Fido")
+	})
+
+	t.Run("Extract cycle", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := env.InsertClass((*RegistryNode)(nil))
+		assert.NilError(t, err)
+		err = env.RegisterType("", reflect.TypeOf(RegistryNode{}))
+		assert.NilError(t, err)
+
+		a, err := env.MakeInstance(`(a of RegistryNode (Name "a") (Next [b]))`)
+		assert.NilError(t, err)
+		_, err = env.MakeInstance(`(b of RegistryNode (Name "b") (Next [a]))`)
+		assert.NilError(t, err)
+
+		var out interface{}
+		err = a.Extract(&out)
+		assert.NilError(t, err)
+		node, ok := out.(*RegistryNode)
+		assert.Assert(t, ok)
+		assert.Equal(t, node.Name, "a")
+		next, ok := node.Next.(*RegistryNode)
+		assert.Assert(t, ok)
+		assert.Equal(t, next.Name, "b")
+		assert.Assert(t, next.Next.(*RegistryNode) == node)
+	})
+
+	t.Run("Unregistered class", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		inst, err := env.Insert("fido", Dog{Animal: Animal{Name: "Fido"}})
+		assert.NilError(t, err)
+
+		var out interface{}
+		err = inst.Extract(&out)
+		assert.NilError(t, err)
+		_, ok := out.(map[string]interface{})
+		assert.Assert(t, ok)
+	})
+}